@@ -0,0 +1,362 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/container/v1"
+)
+
+// fieldDiff is a field of the node pool that differs from the spec
+type fieldDiff struct {
+	field, from, to string
+	// inPlace is false when the pool has to be recreated to change the field
+	inPlace bool
+}
+
+func (d fieldDiff) String() string {
+	how := "update in place"
+	if !d.inPlace {
+		how = "needs recreation"
+	}
+	return fmt.Sprintf("%s: %s -> %s (%s)", d.field, d.from, d.to, how)
+}
+
+func fmtAutoscaling(a *container.NodePoolAutoscaling) string {
+	if a == nil || !a.Enabled {
+		return "off"
+	}
+	return fmt.Sprintf("min %d, max %d", a.MinNodeCount, a.MaxNodeCount)
+}
+
+func fmtManagement(m *container.NodeManagement) string {
+	if m == nil {
+		m = &container.NodeManagement{}
+	}
+	return fmt.Sprintf("autoUpgrade %t, autoRepair %t", m.AutoUpgrade, m.AutoRepair)
+}
+
+func fmtMap(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	kvs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, k+"="+m[k])
+	}
+	return "{" + strings.Join(kvs, ", ") + "}"
+}
+
+// desiredVersion is the node version the spec asks for, "" when it doesn't
+// care
+func (s *nodePoolSpec) desiredVersion(cluster *container.Cluster) string {
+	if s.Version == "latest" {
+		return cluster.CurrentMasterVersion
+	}
+	return s.Version
+}
+
+// diffNodePool compares the spec with the existing pool of size nodes per
+// zone in locations. Only fields the spec sets are compared, the others keep
+// whatever GKE picked.
+func diffNodePool(spec *nodePoolSpec, cluster *container.Cluster, current *container.NodePool, size int64, locations []string) []fieldDiff {
+	desired := spec.nodePool()
+	var diffs []fieldDiff
+
+	add := func(field string, from, to interface{}, inPlace bool) {
+		diffs = append(diffs, fieldDiff{field, fmt.Sprint(from), fmt.Sprint(to), inPlace})
+	}
+
+	// a prefix like 1.11 is converged once the pool runs any 1.11 version
+	if v := spec.desiredVersion(cluster); v != "" && !validVersion([]string{current.Version}, v) {
+		add("version", current.Version, v, true)
+	}
+
+	if spec.Autoscaling != nil && fmtAutoscaling(desired.Autoscaling) != fmtAutoscaling(current.Autoscaling) {
+		add("autoscaling", fmtAutoscaling(current.Autoscaling), fmtAutoscaling(desired.Autoscaling), true)
+	}
+	if spec.Management != nil && fmtManagement(desired.Management) != fmtManagement(current.Management) {
+		add("management", fmtManagement(current.Management), fmtManagement(desired.Management), true)
+	}
+
+	// the autoscaler owns the size of autoscaled pools
+	autoscaled := current.Autoscaling != nil && current.Autoscaling.Enabled
+	if spec.Autoscaling != nil {
+		autoscaled = true
+	}
+	if spec.InitialNodeCount != nil && !autoscaled && *spec.InitialNodeCount != size {
+		add("size", size, *spec.InitialNodeCount, true)
+	}
+
+	dc, cc := desired.Config, current.Config
+	if cc == nil {
+		cc = &container.NodeConfig{}
+	}
+
+	if spec.MachineType != "" && dc.MachineType != cc.MachineType {
+		add("machineType", cc.MachineType, dc.MachineType, false)
+	}
+	if spec.DiskSizeGb != 0 && dc.DiskSizeGb != cc.DiskSizeGb {
+		add("diskSizeGb", cc.DiskSizeGb, dc.DiskSizeGb, false)
+	}
+	if spec.DiskType != "" && dc.DiskType != diskTypeOf(cc) {
+		add("diskType", diskTypeOf(cc), dc.DiskType, false)
+	}
+	if spec.ImageType != "" && !strings.EqualFold(dc.ImageType, cc.ImageType) {
+		add("imageType", cc.ImageType, dc.ImageType, false)
+	}
+	if spec.Preemptible && !cc.Preemptible {
+		add("preemptible", cc.Preemptible, dc.Preemptible, false)
+	}
+	if spec.Labels != nil && !reflect.DeepEqual(dc.Labels, cc.Labels) && len(dc.Labels)+len(cc.Labels) > 0 {
+		add("labels", fmtMap(cc.Labels), fmtMap(dc.Labels), false)
+	}
+	if spec.Metadata != nil && !reflect.DeepEqual(dc.Metadata, cc.Metadata) && len(dc.Metadata)+len(cc.Metadata) > 0 {
+		add("metadata", fmtMap(cc.Metadata), fmtMap(dc.Metadata), false)
+	}
+	if spec.OauthScopes != nil && !sameStrings(dc.OauthScopes, cc.OauthScopes) {
+		add("oauthScopes", cc.OauthScopes, dc.OauthScopes, false)
+	}
+	if spec.ServiceAccount != "" && dc.ServiceAccount != cc.ServiceAccount {
+		add("serviceAccount", cc.ServiceAccount, dc.ServiceAccount, false)
+	}
+	if spec.LocalSsdCount != 0 && dc.LocalSsdCount != cc.LocalSsdCount {
+		add("localSsdCount", cc.LocalSsdCount, dc.LocalSsdCount, false)
+	}
+	if spec.Taints != nil && !sameStrings(fmtTaints(dc.Taints), fmtTaints(cc.Taints)) {
+		add("taints", fmtTaints(cc.Taints), fmtTaints(dc.Taints), false)
+	}
+	if spec.Tags != nil && !sameStrings(dc.Tags, cc.Tags) {
+		add("tags", cc.Tags, dc.Tags, false)
+	}
+	if spec.NodeLocations != nil && !sameStrings(spec.NodeLocations, locations) {
+		add("nodeLocations", locations, spec.NodeLocations, false)
+	}
+
+	return diffs
+}
+
+// diskTypeOf is the boot disk type of nodes built from the config
+func diskTypeOf(c *container.NodeConfig) string {
+	if c.DiskType == "" {
+		return defaultDiskType
+	}
+	return c.DiskType
+}
+
+// fmtTaints lists the taints as key=value:EFFECT
+func fmtTaints(taints []*container.NodeTaint) []string {
+	s := make([]string, 0, len(taints))
+	for _, t := range taints {
+		s = append(s, fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect))
+	}
+	return s
+}
+
+// sameStrings compares string lists as sets
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	return reflect.DeepEqual(a, b)
+}
+
+// poolSize returns the number of nodes per zone of the pool, the target size
+// of its first instance group
+func (cl *client) poolSize(projectID string, np *container.NodePool) (int64, error) {
+	if len(np.InstanceGroupUrls) == 0 {
+		return 0, fmt.Errorf("node pool %s has no instance groups", np.Name)
+	}
+
+	url := np.InstanceGroupUrls[0]
+	parts := strings.Split(url, "/")
+	if len(parts) < 4 || parts[len(parts)-2] != "instanceGroupManagers" || parts[len(parts)-4] != "zones" {
+		return 0, fmt.Errorf("unexpected instance group url %s", url)
+	}
+
+	ig, err := cl.computeClient.InstanceGroupManagers.Get(projectID, parts[len(parts)-3], parts[len(parts)-1]).Do()
+	if err != nil {
+		return 0, apiError(fmt.Sprintf("failed to get instance group %s", url), err)
+	}
+	return ig.TargetSize, nil
+}
+
+// diffExisting compares the spec with the existing pool, looking its size and
+// node locations up only when the spec sets them
+func (cl *client) diffExisting(projectID, zone string, cluster *container.Cluster, current *container.NodePool, spec *nodePoolSpec) ([]fieldDiff, error) {
+	var size int64
+	if spec.InitialNodeCount != nil {
+		var err error
+		if size, err = cl.poolSize(projectID, current); err != nil {
+			return nil, err
+		}
+	}
+
+	var locations []string
+	if spec.NodeLocations != nil {
+		var err error
+		if locations, err = cl.nodePoolLocations(projectID, zone, cluster.Name, current.Name); err != nil {
+			return nil, apiError(fmt.Sprintf("failed to get the locations of node pool %s", current.Name), err)
+		}
+	}
+
+	return diffNodePool(spec, cluster, current, size, locations), nil
+}
+
+// applyNodePool makes the node pool match the spec: it creates it when it
+// doesn't exist, otherwise prints the diff and makes the changes that can be
+// made in place. Fields that need the pool recreated are only reported.
+func (cl *client) applyNodePool(projectID, zone string, cluster *container.Cluster, spec *nodePoolSpec) error {
+	current, err := cl.containerClient.Projects.Zones.Clusters.NodePools.Get(projectID, zone, cluster.Name, spec.Name).Do()
+	if isNotFound(err) {
+		return cl.createNodePool(projectID, zone, cluster, spec)
+	}
+	if err != nil {
+		return apiError(fmt.Sprintf("failed to get node pool %s", spec.Name), err)
+	}
+
+	diffs, err := cl.diffExisting(projectID, zone, cluster, current, spec)
+	if err != nil {
+		return err
+	}
+	if len(diffs) == 0 {
+		fmt.Printf("Node pool %s is up to date\n", spec.Name)
+		return nil
+	}
+
+	fmt.Printf("Node pool %s differs from the spec:\n", spec.Name)
+	var inPlace, recreate []fieldDiff
+	for _, d := range diffs {
+		fmt.Printf("\t%s\n", d)
+		if d.inPlace {
+			inPlace = append(inPlace, d)
+		} else {
+			recreate = append(recreate, d)
+		}
+	}
+
+	if len(inPlace) > 0 {
+		if !confirm(fmt.Sprintf("Update node pool %s in place?", spec.Name)) {
+			fmt.Println("Skipping update")
+			return nil
+		}
+		for _, d := range inPlace {
+			if err := cl.updateField(projectID, zone, cluster, spec, d); err != nil {
+				return apiError(fmt.Sprintf("failed to update %s of node pool %s", d.field, spec.Name), err)
+			}
+		}
+	}
+
+	if len(recreate) > 0 {
+		fields := make([]string, 0, len(recreate))
+		for _, d := range recreate {
+			fields = append(fields, d.field)
+		}
+		fmt.Printf("Not changed, node pool %s has to be recreated for: %s (see update-nodepool migrate)\n",
+			spec.Name, strings.Join(fields, ", "))
+	}
+
+	return nil
+}
+
+// updateField makes one in-place change and follows its operation; GKE runs
+// one operation on a cluster at a time
+func (cl *client) updateField(projectID, zone string, cluster *container.Cluster, spec *nodePoolSpec, d fieldDiff) error {
+	pools := cl.containerClient.Projects.Zones.Clusters.NodePools
+	desired := spec.nodePool()
+
+	var op *container.Operation
+	var err error
+
+	switch d.field {
+	case "version":
+		op, err = pools.Update(projectID, zone, cluster.Name, spec.Name, &container.UpdateNodePoolRequest{
+			NodeVersion: spec.desiredVersion(cluster),
+		}).Do()
+	case "autoscaling":
+		a := desired.Autoscaling
+		a.ForceSendFields = []string{"Enabled", "MinNodeCount", "MaxNodeCount"}
+		op, err = pools.Autoscaling(projectID, zone, cluster.Name, spec.Name, &container.SetNodePoolAutoscalingRequest{
+			Autoscaling: a,
+		}).Do()
+	case "management":
+		m := desired.Management
+		m.ForceSendFields = []string{"AutoUpgrade", "AutoRepair"}
+		op, err = pools.SetManagement(projectID, zone, cluster.Name, spec.Name, &container.SetNodePoolManagementRequest{
+			Management: m,
+		}).Do()
+	case "size":
+		op, err = pools.SetSize(projectID, zone, cluster.Name, spec.Name, &container.SetNodePoolSizeRequest{
+			NodeCount:       *spec.InitialNodeCount,
+			ForceSendFields: []string{"NodeCount"},
+		}).Do()
+	default:
+		return fmt.Errorf("%s can't be updated in place", d.field)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("We're going to %s, status %s, id: %s\n", op.OperationType, op.Status, op.Name)
+
+	if _, err := followOperation(cl.containerClient, projectID, zone, op.Name, *timeout); err != nil && err != errDetached {
+		return err
+	}
+	return nil
+}
+
+// createNodePool validates the pool of the spec against its zones, the node
+// locations of the spec or else the cluster's, checks quota, shows the cost
+// and creates the pool
+func (cl *client) createNodePool(projectID, zone string, cluster *container.Cluster, spec *nodePoolSpec) error {
+	np := spec.nodePool()
+	zones := spec.NodeLocations
+	if len(zones) == 0 {
+		zones = nodeZones(cluster, zone)
+	}
+
+	if err := cl.checkNodePool(projectID, zone, zones, np); err != nil {
+		return fmt.Errorf("node pool %s: %v", np.Name, err)
+	}
+
+	// the initial node count is per zone of the pool
+	nodes := np.InitialNodeCount
+	if len(zones) > 1 {
+		nodes *= int64(len(zones))
+	}
+
+	needs, err := cl.quotaNeeds(projectID, zone, np.Config, nodes)
+	if err != nil {
+		return err
+	}
+	if err := cl.checkQuota(projectID, zone, needs); err != nil {
+		return err
+	}
+
+	printCostDelta(regionOf(zone), np.Config, nodes)
+	if !confirm(fmt.Sprintf("Create node pool %s with %d nodes?", np.Name, nodes)) {
+		fmt.Println("Skipping create")
+		return nil
+	}
+
+	op, err := cl.createNodePoolIn(projectID, zone, cluster.Name, np, spec.NodeLocations)
+	if err != nil {
+		return apiError(fmt.Sprintf("failed to create node pool %s", np.Name), err)
+	}
+
+	fmt.Printf("We're going to %s, status %s, id: %s\n", op.OperationType, op.Status, op.Name)
+
+	if _, err := followOperation(cl.containerClient, projectID, zone, op.Name, *timeout); err != nil && err != errDetached {
+		return err
+	}
+	return nil
+}
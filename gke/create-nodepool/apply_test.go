@@ -0,0 +1,163 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/container/v1"
+)
+
+func TestDiffNodePool(t *testing.T) {
+	cluster := &container.Cluster{
+		Name:                 "prod",
+		CurrentMasterVersion: "1.11.5-gke.5",
+		Locations:            []string{"europe-west1-b", "europe-west1-c"},
+	}
+	pool := func() *container.NodePool {
+		return &container.NodePool{
+			Name:    "batch",
+			Version: "1.11.5-gke.5",
+			Config: &container.NodeConfig{
+				MachineType: "n1-standard-1",
+				DiskSizeGb:  100,
+				ImageType:   "COS",
+				Labels:      map[string]string{"workload": "batch"},
+				Taints: []*container.NodeTaint{
+					{Key: "dedicated", Value: "batch", Effect: "NO_SCHEDULE"},
+				},
+				Tags: []string{"a", "b"},
+			},
+			Management: &container.NodeManagement{AutoUpgrade: true, AutoRepair: true},
+		}
+	}
+	count := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name      string
+		spec      *nodePoolSpec
+		current   *container.NodePool
+		size      int64
+		locations []string
+		want      []fieldDiff
+	}{
+		{
+			name:    "unset fields are not compared",
+			spec:    &nodePoolSpec{Name: "batch"},
+			current: pool(),
+		},
+		{
+			name:    "same pool",
+			spec:    &nodePoolSpec{Name: "batch", Version: "latest", MachineType: "n1-standard-1", DiskSizeGb: 100, ImageType: "cos", Tags: []string{"b", "a"}},
+			current: pool(),
+		},
+		{
+			name:    "latest is the master version",
+			spec:    &nodePoolSpec{Name: "batch", Version: "latest"},
+			current: func() *container.NodePool { np := pool(); np.Version = "1.10.9-gke.5"; return np }(),
+			want:    []fieldDiff{{"version", "1.10.9-gke.5", "1.11.5-gke.5", true}},
+		},
+		{
+			name:    "a version prefix matches",
+			spec:    &nodePoolSpec{Name: "batch", Version: "1.11"},
+			current: pool(),
+		},
+		{
+			name:    "a version prefix of another minor",
+			spec:    &nodePoolSpec{Name: "batch", Version: "1.12"},
+			current: pool(),
+			want:    []fieldDiff{{"version", "1.11.5-gke.5", "1.12", true}},
+		},
+		{
+			name:    "a version prefix is not a string prefix",
+			spec:    &nodePoolSpec{Name: "batch", Version: "1.1"},
+			current: pool(),
+			want:    []fieldDiff{{"version", "1.11.5-gke.5", "1.1", true}},
+		},
+		{
+			name:    "size",
+			spec:    &nodePoolSpec{Name: "batch", InitialNodeCount: count(3)},
+			current: pool(),
+			size:    2,
+			want:    []fieldDiff{{"size", "2", "3", true}},
+		},
+		{
+			name: "the autoscaler owns the size",
+			spec: &nodePoolSpec{Name: "batch", InitialNodeCount: count(3)},
+			current: func() *container.NodePool {
+				np := pool()
+				np.Autoscaling = &container.NodePoolAutoscaling{Enabled: true, MinNodeCount: 1, MaxNodeCount: 5}
+				return np
+			}(),
+			size: 2,
+		},
+		{
+			name:    "autoscaling and management",
+			spec:    &nodePoolSpec{Name: "batch", Autoscaling: &autoscalingSpec{Min: 1, Max: 5}, Management: &managementSpec{AutoUpgrade: true}},
+			current: pool(),
+			want: []fieldDiff{
+				{"autoscaling", "off", "min 1, max 5", true},
+				{"management", "autoUpgrade true, autoRepair true", "autoUpgrade true, autoRepair false", true},
+			},
+		},
+		{
+			name:    "machine type needs recreation",
+			spec:    &nodePoolSpec{Name: "batch", MachineType: "n1-highmem-4"},
+			current: pool(),
+			want:    []fieldDiff{{"machineType", "n1-standard-1", "n1-highmem-4", false}},
+		},
+		{
+			name:    "disk type defaults to pd-standard",
+			spec:    &nodePoolSpec{Name: "batch", DiskType: "pd-standard"},
+			current: pool(),
+		},
+		{
+			name:    "disk type",
+			spec:    &nodePoolSpec{Name: "batch", DiskType: "pd-ssd"},
+			current: pool(),
+			want:    []fieldDiff{{"diskType", "pd-standard", "pd-ssd", false}},
+		},
+		{
+			name:    "same taints",
+			spec:    &nodePoolSpec{Name: "batch", Taints: []taintSpec{{Key: "dedicated", Value: "batch", Effect: "NoSchedule"}}},
+			current: pool(),
+		},
+		{
+			name:    "taints",
+			spec:    &nodePoolSpec{Name: "batch", Taints: []taintSpec{{Key: "dedicated", Value: "batch", Effect: "NoExecute"}}},
+			current: pool(),
+			want:    []fieldDiff{{"taints", "[dedicated=batch:NO_SCHEDULE]", "[dedicated=batch:NO_EXECUTE]", false}},
+		},
+		{
+			name:    "labels",
+			spec:    &nodePoolSpec{Name: "batch", Labels: map[string]string{}},
+			current: pool(),
+			want:    []fieldDiff{{"labels", "{workload=batch}", "{}", false}},
+		},
+		{
+			name:      "same node locations",
+			spec:      &nodePoolSpec{Name: "batch", NodeLocations: []string{"europe-west1-c", "europe-west1-b"}},
+			current:   pool(),
+			locations: []string{"europe-west1-b", "europe-west1-c"},
+		},
+		{
+			name:      "node locations",
+			spec:      &nodePoolSpec{Name: "batch", NodeLocations: []string{"europe-west1-b"}},
+			current:   pool(),
+			locations: []string{"europe-west1-b", "europe-west1-c"},
+			want:      []fieldDiff{{"nodeLocations", "[europe-west1-b europe-west1-c]", "[europe-west1-b]", false}},
+		},
+		{
+			name:    "pool without config",
+			spec:    &nodePoolSpec{Name: "batch", MachineType: "n1-standard-1"},
+			current: &container.NodePool{Name: "batch"},
+			want:    []fieldDiff{{"machineType", "", "n1-standard-1", false}},
+		},
+	}
+
+	for _, tt := range tests {
+		got := diffNodePool(tt.spec, cluster, tt.current, tt.size, tt.locations)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: diffNodePool() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// apiError turns an API error about what into a message saying what to do
+// about it
+func apiError(what string, err error) error {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return fmt.Errorf("%s: %v", what, err)
+	}
+
+	switch e.Code {
+	case http.StatusBadRequest:
+		return fmt.Errorf("%s: rejected by the API: %s", what, e.Message)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%s: not authenticated, run gcloud auth application-default login or set GOOGLE_APPLICATION_CREDENTIALS", what)
+	case http.StatusForbidden:
+		return fmt.Errorf("%s: permission denied, check the credentials have access to the project and the API is enabled: %s", what, e.Message)
+	case http.StatusNotFound:
+		return fmt.Errorf("%s: not found, check GKE_PROJECT_ID, GKE_ZONE and the name", what)
+	case http.StatusConflict:
+		return fmt.Errorf("%s: already exists or another operation is running on the cluster, retry once it is done", what)
+	case http.StatusTooManyRequests:
+		return fmt.Errorf("%s: rate limited or out of quota, retry later: %s", what, e.Message)
+	}
+	if e.Code >= 500 {
+		return fmt.Errorf("%s: the API failed with %d, retry later: %s", what, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s: %v", what, err)
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusNotFound
+}
+
+// nodeZones are the zones the cluster creates nodes in
+func nodeZones(cluster *container.Cluster, zone string) []string {
+	if len(cluster.Locations) > 0 {
+		return cluster.Locations
+	}
+	return []string{zone}
+}
+
+// checkNodePool validates the node pool against what its zones offer: machine
+// type, disk type, accelerators, image type and version
+func (cl *client) checkNodePool(projectID, zone string, zones []string, np *container.NodePool) error {
+	var errs specErrors
+	c := np.Config
+
+	for _, z := range zones {
+		if _, err := cl.computeClient.MachineTypes.Get(projectID, z, c.MachineType).Do(); isNotFound(err) {
+			errs.add("machineType", "%s is not available in %s, list them with gcloud compute machine-types list --zones %s", c.MachineType, z, z)
+		} else if err != nil {
+			return apiError(fmt.Sprintf("failed to get machine type %s", c.MachineType), err)
+		}
+
+		if _, err := cl.computeClient.DiskTypes.Get(projectID, z, diskTypeOf(c)).Do(); isNotFound(err) {
+			errs.add("diskType", "%s is not available in %s, list them with gcloud compute disk-types list --zones %s", diskTypeOf(c), z, z)
+		} else if err != nil {
+			return apiError(fmt.Sprintf("failed to get disk type %s", diskTypeOf(c)), err)
+		}
+
+		for i, a := range c.Accelerators {
+			field := fmt.Sprintf("accelerators[%d]", i)
+			at, err := cl.computeClient.AcceleratorTypes.Get(projectID, z, a.AcceleratorType).Do()
+			if isNotFound(err) {
+				errs.add(field+".type", "%s is not available in %s, list them with gcloud compute accelerator-types list", a.AcceleratorType, z)
+				continue
+			}
+			if err != nil {
+				return apiError(fmt.Sprintf("failed to get accelerator type %s", a.AcceleratorType), err)
+			}
+			if at.MaximumCardsPerInstance > 0 && a.AcceleratorCount > at.MaximumCardsPerInstance {
+				errs.add(field+".count", "%d is more than the %d %s a node can have", a.AcceleratorCount, at.MaximumCardsPerInstance, a.AcceleratorType)
+			}
+		}
+	}
+
+	sc, err := cl.containerClient.Projects.Zones.GetServerconfig(projectID, zone).Do()
+	if err != nil {
+		return apiError(fmt.Sprintf("failed to get the server config of %s", zone), err)
+	}
+
+	if c.ImageType != "" && !containsFold(sc.ValidImageTypes, c.ImageType) {
+		errs.add("imageType", "%s is not one of %s", c.ImageType, strings.Join(sc.ValidImageTypes, ", "))
+	}
+	if v := np.Version; v != "" && v != "latest" && !validVersion(sc.ValidNodeVersions, v) {
+		errs.add("version", "%s is not a valid node version in %s, valid are %s", v, zone, strings.Join(sc.ValidNodeVersions, ", "))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func containsFold(list []string, s string) bool {
+	for _, l := range list {
+		if strings.EqualFold(l, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// validVersion accepts a valid version or a prefix of one, e.g. 1.9 for 1.9.7-gke.0
+func validVersion(valid []string, v string) bool {
+	for _, vv := range valid {
+		if vv == v || strings.HasPrefix(vv, v+".") || strings.HasPrefix(vv, v+"-") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pondohva/golang-samples/gke/pricing"
+	"google.golang.org/api/container/v1"
+)
+
+// GKE node boot disks are standard persistent disks unless the spec sets
+// diskType
+const defaultDiskType = pricing.DefaultDiskType
+
+// pricedNode is the node config as the shared pricing package prices it
+func pricedNode(config *container.NodeConfig) pricing.Node {
+	return pricing.Node{
+		MachineType:   config.MachineType,
+		DiskSizeGb:    config.DiskSizeGb,
+		DiskType:      config.DiskType,
+		LocalSsdCount: config.LocalSsdCount,
+		Preemptible:   config.Preemptible,
+	}
+}
+
+// printCostDelta prints what adding nodes built from the node config costs
+func printCostDelta(region string, config *container.NodeConfig, nodes int64) {
+	pricing.PrintCostDelta(*pricingFile, region, pricedNode(config), nodes)
+}
+
+// confirm asks the question on a terminal. Without one, or with --yes, the
+// change goes ahead as it always did.
+func confirm(question string) bool {
+	if *yes {
+		return true
+	}
+
+	if !isTerminal() {
+		return true
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	var answer string
+	fmt.Scanln(&answer)
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// isTerminal tells whether stdin is a terminal to ask questions on
+func isTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	nodePoolLabel         = "cloud.google.com/gke-nodepool"
+	evictionRetryInterval = 5 * time.Second
+	mirrorPodAnnotation   = "kubernetes.io/config.mirror"
+)
+
+func poolNodes(kc *kubernetes.Clientset, nodePoolID string) ([]v1.Node, error) {
+	nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", nodePoolLabel, nodePoolID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes of %s: %v", nodePoolID, err)
+	}
+	return nodes.Items, nil
+}
+
+func cordonPool(kc *kubernetes.Clientset, nodePoolID string) error {
+	nodes, err := poolNodes(kc, nodePoolID)
+	if err != nil {
+		return err
+	}
+
+	for i := range nodes {
+		n := &nodes[i]
+		if n.Spec.Unschedulable {
+			continue
+		}
+		n.Spec.Unschedulable = true
+		if _, err := kc.CoreV1().Nodes().Update(n); err != nil {
+			return fmt.Errorf("failed to cordon %s: %v", n.Name, err)
+		}
+		fmt.Printf("Cordoned %s\n", n.Name)
+	}
+
+	return nil
+}
+
+// drainPool cordons the nodes of the pool and evicts their pods,
+// --drain-batch nodes at a time
+func drainPool(kc *kubernetes.Clientset, nodePoolID string) error {
+	if err := cordonPool(kc, nodePoolID); err != nil {
+		return err
+	}
+
+	nodes, err := poolNodes(kc, nodePoolID)
+	if err != nil {
+		return err
+	}
+
+	batch := *drainBatch
+	if batch < 1 {
+		batch = 1
+	}
+
+	for len(nodes) > 0 {
+		n := batch
+		if n > len(nodes) {
+			n = len(nodes)
+		}
+
+		names := make([]string, 0, n)
+		for _, node := range nodes[:n] {
+			names = append(names, node.Name)
+		}
+
+		fmt.Printf("Draining %v\n", names)
+		if err := drainNodes(kc, names, *drainTimeout); err != nil {
+			return err
+		}
+		nodes = nodes[n:]
+	}
+
+	return nil
+}
+
+// drainNodes evicts the pods of the nodes and waits for them to be gone.
+// Evictions refused by a PodDisruptionBudget are retried until timeout.
+func drainNodes(kc *kubernetes.Clientset, names []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		var remaining []v1.Pod
+		for _, name := range names {
+			pods, err := evictablePods(kc, name)
+			if err != nil {
+				return err
+			}
+			remaining = append(remaining, pods...)
+		}
+
+		if len(remaining) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s draining %v, %d pods left, first %s/%s",
+				timeout, names, len(remaining), remaining[0].Namespace, remaining[0].Name)
+		}
+
+		for _, p := range remaining {
+			if p.DeletionTimestamp != nil {
+				continue
+			}
+
+			err := kc.PolicyV1beta1().Evictions(p.Namespace).Evict(&policy.Eviction{
+				ObjectMeta: metav1.ObjectMeta{Name: p.Name, Namespace: p.Namespace},
+			})
+			switch {
+			case err == nil:
+				fmt.Printf("Evicted %s/%s\n", p.Namespace, p.Name)
+			case apierrors.IsNotFound(err):
+			case apierrors.IsTooManyRequests(err):
+				fmt.Printf("Eviction of %s/%s refused by a disruption budget, retrying\n", p.Namespace, p.Name)
+			default:
+				return fmt.Errorf("failed to evict %s/%s: %v", p.Namespace, p.Name, err)
+			}
+		}
+
+		time.Sleep(evictionRetryInterval)
+	}
+}
+
+// evictablePods returns the pods of the node that a drain has to move:
+// not mirror pods, not DaemonSet pods and not finished ones
+func evictablePods(kc *kubernetes.Clientset, nodeName string) ([]v1.Pod, error) {
+	pods, err := kc.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "spec.nodeName=" + nodeName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods of %s: %v", nodeName, err)
+	}
+
+	var evictable []v1.Pod
+
+	for _, p := range pods.Items {
+		if _, mirror := p.Annotations[mirrorPodAnnotation]; mirror {
+			continue
+		}
+		if p.Status.Phase == v1.PodSucceeded || p.Status.Phase == v1.PodFailed {
+			continue
+		}
+		if ref := metav1.GetControllerOf(&p); ref != nil && ref.Kind == "DaemonSet" {
+			continue
+		}
+		evictable = append(evictable, p)
+	}
+
+	return evictable, nil
+}
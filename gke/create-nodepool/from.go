@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/container/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// specFromPool returns the spec of an existing node pool: its version, size,
+// autoscaling, management, node config and node locations
+func (cl *client) specFromPool(projectID, zone, clusterID string, np *container.NodePool) (*nodePoolSpec, error) {
+	spec := &nodePoolSpec{
+		Version: np.Version,
+	}
+
+	locations, err := cl.nodePoolLocations(projectID, zone, clusterID, np.Name)
+	if err != nil {
+		return nil, apiError(fmt.Sprintf("failed to get the locations of node pool %s", np.Name), err)
+	}
+	spec.NodeLocations = locations
+
+	size, err := cl.poolSize(projectID, np)
+	if err != nil {
+		fmt.Printf("Using the initial node count of %s: %v\n", np.Name, err)
+		size = np.InitialNodeCount
+	}
+	spec.InitialNodeCount = &size
+
+	if a := np.Autoscaling; a != nil && a.Enabled {
+		spec.Autoscaling = &autoscalingSpec{Min: a.MinNodeCount, Max: a.MaxNodeCount}
+	}
+	if m := np.Management; m != nil {
+		spec.Management = &managementSpec{AutoUpgrade: m.AutoUpgrade, AutoRepair: m.AutoRepair}
+	}
+
+	if c := np.Config; c != nil {
+		spec.MachineType = c.MachineType
+		spec.DiskSizeGb = c.DiskSizeGb
+		spec.DiskType = c.DiskType
+		spec.ImageType = c.ImageType
+		spec.Preemptible = c.Preemptible
+		spec.Labels = c.Labels
+		for _, t := range c.Taints {
+			spec.Taints = append(spec.Taints, taintSpec{Key: t.Key, Value: t.Value, Effect: taintEffectOf(t.Effect)})
+		}
+		spec.Metadata = c.Metadata
+		spec.OauthScopes = c.OauthScopes
+		spec.ServiceAccount = c.ServiceAccount
+		spec.LocalSsdCount = c.LocalSsdCount
+		spec.Tags = c.Tags
+		spec.MinCpuPlatform = c.MinCpuPlatform
+		for _, a := range c.Accelerators {
+			spec.Accelerators = append(spec.Accelerators, acceleratorSpec{Type: a.AcceleratorType, Count: a.AcceleratorCount})
+		}
+	}
+
+	return spec, nil
+}
+
+// taintEffectOf maps a taint effect of the API back to the Kubernetes one
+func taintEffectOf(effect string) string {
+	for k, e := range taintEffects {
+		if e == effect {
+			return k
+		}
+	}
+	return effect
+}
+
+// override replaces the fields of the spec that o sets
+func (s *nodePoolSpec) override(o *nodePoolSpec) {
+	if o.Name != "" {
+		s.Name = o.Name
+	}
+	if o.Version != "" {
+		s.Version = o.Version
+	}
+	if o.InitialNodeCount != nil {
+		s.InitialNodeCount = o.InitialNodeCount
+	}
+	if o.Autoscaling != nil {
+		s.Autoscaling = o.Autoscaling
+		// the copied size may be outside the new limits
+		if o.InitialNodeCount == nil {
+			s.InitialNodeCount = nil
+		}
+	}
+	if o.Management != nil {
+		s.Management = o.Management
+	}
+	if o.MachineType != "" {
+		s.MachineType = o.MachineType
+	}
+	if o.DiskSizeGb != 0 {
+		s.DiskSizeGb = o.DiskSizeGb
+	}
+	if o.DiskType != "" {
+		s.DiskType = o.DiskType
+	}
+	if o.ImageType != "" {
+		s.ImageType = o.ImageType
+	}
+	if o.Preemptible {
+		s.Preemptible = true
+	}
+	if o.Labels != nil {
+		s.Labels = o.Labels
+	}
+	if o.Taints != nil {
+		s.Taints = o.Taints
+	}
+	if o.Metadata != nil {
+		s.Metadata = o.Metadata
+	}
+	if o.OauthScopes != nil {
+		s.OauthScopes = o.OauthScopes
+	}
+	if o.ServiceAccount != "" {
+		s.ServiceAccount = o.ServiceAccount
+	}
+	if o.LocalSsdCount != 0 {
+		s.LocalSsdCount = o.LocalSsdCount
+	}
+	if o.Tags != nil {
+		s.Tags = o.Tags
+	}
+	if o.NodeLocations != nil {
+		s.NodeLocations = o.NodeLocations
+	}
+	if o.Accelerators != nil {
+		s.Accelerators = o.Accelerators
+	}
+	if o.MinCpuPlatform != "" {
+		s.MinCpuPlatform = o.MinCpuPlatform
+	}
+}
+
+// cloneNodePool creates a node pool like the source pool with the overrides
+// of spec, in the source's node locations unless they are overridden
+func (cl *client) cloneNodePool(projectID, zone string, cluster *container.Cluster, sourceID string, overrides *nodePoolSpec) error {
+	src, err := cl.containerClient.Projects.Zones.Clusters.NodePools.Get(projectID, zone, cluster.Name, sourceID).Do()
+	if err != nil {
+		return apiError(fmt.Sprintf("failed to get node pool %s", sourceID), err)
+	}
+
+	spec, err := cl.specFromPool(projectID, zone, cluster.Name, src)
+	if err != nil {
+		return err
+	}
+	spec.override(overrides)
+
+	if spec.Name == src.Name {
+		return fmt.Errorf("the new node pool needs a name other than %s", src.Name)
+	}
+	for _, np := range cluster.NodePools {
+		if np.Name == spec.Name {
+			return fmt.Errorf("node pool %s already exists in cluster %s", spec.Name, cluster.Name)
+		}
+	}
+
+	data, err := yaml.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Node pool %s from %s:\n\t%s\n", spec.Name, src.Name,
+		strings.Replace(strings.TrimSpace(string(data)), "\n", "\n\t", -1))
+
+	if err := spec.validate(); err != nil {
+		return err
+	}
+
+	return cl.createNodePool(projectID, zone, cluster, spec)
+}
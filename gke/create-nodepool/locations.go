@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/container/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// The vendored container/v1 client predates NodePool.Locations, and the
+// clients that have it need packages this tool doesn't vendor, so the node
+// locations of a pool are sent and read as JSON here.
+
+// createNodePoolIn creates the node pool with nodes in locations, or in the
+// cluster's locations when there are none
+func (cl *client) createNodePoolIn(projectID, zone, clusterID string, np *container.NodePool, locations []string) (*container.Operation, error) {
+	req := &container.CreateNodePoolRequest{NodePool: np}
+	if len(locations) == 0 {
+		return cl.containerClient.Projects.Zones.Clusters.NodePools.Create(projectID, zone, clusterID, req).Do()
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var body struct {
+		NodePool map[string]interface{} `json:"nodePool"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	body.NodePool["locations"] = locations
+
+	var op container.Operation
+	path := fmt.Sprintf("v1/projects/%s/zones/%s/clusters/%s/nodePools", projectID, zone, clusterID)
+	if err := cl.callContainer("POST", path, body, &op); err != nil {
+		return nil, err
+	}
+	return &op, nil
+}
+
+// nodePoolLocations returns the zones the nodes of the node pool are in
+func (cl *client) nodePoolLocations(projectID, zone, clusterID, nodePoolID string) ([]string, error) {
+	var np struct {
+		Locations []string `json:"locations"`
+	}
+	path := fmt.Sprintf("v1/projects/%s/zones/%s/clusters/%s/nodePools/%s", projectID, zone, clusterID, nodePoolID)
+	if err := cl.callContainer("GET", path, nil, &np); err != nil {
+		return nil, err
+	}
+	return np.Locations, nil
+}
+
+// callContainer sends body, when not nil, to the container API like the
+// generated client does and decodes the response into v
+func (cl *client) callContainer(method, path string, body, v interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, cl.containerClient.BasePath+path, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := cl.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -1,16 +1,44 @@
 package main
 
 import (
-	"log"
 	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
 	"golang.org/x/oauth2/google"
+	compute "google.golang.org/api/compute/v1"
 	"google.golang.org/api/container/v1"
-	"os"
+)
+
+// GKE uses this machine type when the pool doesn't set one
+const defaultMachineType = "n1-standard-1"
 
+var (
+	pricingFile = flag.String("pricing", "", "pricing table used for cost estimates, by default pricing.json next to the binary or in its parent directory")
+	yes         = flag.Bool("yes", false, "don't ask for confirmation")
+	timeout     = flag.Duration("timeout", time.Hour, "how long to follow the started operation")
+	specFile    = flag.String("spec", "", "YAML or JSON file describing the node pool")
+	from        = flag.String("from", "", "copy the config of this node pool, overridden by the spec and flags")
+	machineType = flag.String("machine-type", "", "machine type, overrides the spec")
+	nodeCount   = flag.Int64("node-count", 0, "initial number of nodes per zone, overrides the spec")
+
+	manifestFile = flag.String("manifest", "nodepools.yaml", "reconcile: YAML or JSON file with every node pool of the cluster")
+	planFile     = flag.String("plan", "reconcile-plan.yaml", "reconcile: file the plan is saved to and applied from")
+	prune        = flag.Bool("prune", false, "reconcile: drain and delete node pools missing from the manifest, without a terminal only with --yes")
+	interval     = flag.Duration("interval", 0, "reconcile: plan and apply again at this interval")
+	drainBatch   = flag.Int("drain-batch", 1, "how many nodes to drain at a time")
+	drainTimeout = flag.Duration("drain-timeout", 10*time.Minute, "how long to wait for a batch of nodes to drain")
 )
 
 type client struct {
 	containerClient *container.Service
+	computeClient   *compute.Service
+	// httpClient is the authorized client of both, see locations.go
+	httpClient *http.Client
 }
 
 func NewClient(ctx context.Context) *client {
@@ -25,13 +53,21 @@ func NewClient(ctx context.Context) *client {
 		log.Panic(err)
 	}
 
+	computeSvc, err := compute.New(hc)
+
+	if err != nil {
+		log.Panic(err)
+	}
 
 	return &client{
 		containerClient: containerSvc,
+		computeClient:   computeSvc,
+		httpClient:      hc,
 	}
 }
 
 func main() {
+	flag.Parse()
 	ctx := context.Background()
 
 	projectID, ok := os.LookupEnv("GKE_PROJECT_ID")
@@ -42,33 +78,81 @@ func main() {
 	if !ok {
 		log.Fatal("set GKE_ZONE")
 	}
+
+	if flag.Arg(0) == "wait-op" {
+		cl := NewClient(ctx)
+		if err := waitOperation(cl.containerClient, projectID, zone, flag.Arg(1), *timeout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "reconcile" {
+		cl := NewClient(ctx)
+		if err := cl.runReconcile(projectID, zone, flag.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	clusterID, ok := os.LookupEnv("GKE_CLUSTER_ID")
 	if !ok {
 		log.Fatal("set GKE_CLUSTER_ID")
 	}
-	nodePoolID, ok := os.LookupEnv("GKE_NODE_POOL_ID")
-	if !ok {
-		log.Fatal("set GKE_NODE_POOL_ID")
+	spec := &nodePoolSpec{}
+	if *specFile != "" {
+		var err error
+		if spec, err = loadSpec(*specFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// the environment fills in what the spec leaves out
+	if spec.Name == "" {
+		spec.Name, ok = os.LookupEnv("GKE_NODE_POOL_ID")
+		if !ok {
+			log.Fatal("set GKE_NODE_POOL_ID or name in the spec")
+		}
+	}
+	// a clone keeps the machine type of its source unless the spec or
+	// --machine-type asks for another, the environment may be set for a
+	// different pool
+	if env := os.Getenv("GKE_MACHINE_TYPE"); spec.MachineType == "" && env != "" {
+		if *from == "" {
+			spec.MachineType = env
+		} else if *machineType == "" {
+			fmt.Printf("Ignoring GKE_MACHINE_TYPE=%s, the clone keeps the machine type of %s; use --machine-type to change it\n", env, *from)
+		}
+	}
+	if *machineType != "" {
+		spec.MachineType = *machineType
+	}
+	if *nodeCount > 0 {
+		spec.InitialNodeCount = nodeCount
 	}
 
-	machineType, ok := os.LookupEnv("GKE_MACHINE_TYPE")
+	// a clone is validated once the source pool is filled in
+	if *from == "" {
+		if err := spec.validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	cl := NewClient(ctx)
 
-	req := container.CreateNodePoolRequest{
-		NodePool: &container.NodePool{
-			InitialNodeCount: int64(1),
-			Name: nodePoolID,
-			Config: &container.NodeConfig{
-				MachineType: machineType,
-			},
-			Version: "latest",
-		},
+	cluster, err := cl.containerClient.Projects.Zones.Clusters.Get(projectID, zone, clusterID).Do()
+	if err != nil {
+		log.Fatal(apiError(fmt.Sprintf("failed to get cluster %s", clusterID), err))
 	}
 
-	_, err := cl.containerClient.Projects.Zones.Clusters.NodePools.Create(projectID, zone, clusterID, &req).Do()
-	if err != nil {
-		log.Fatal("failed to get nodepools")
+	if *from != "" {
+		if err := cl.cloneNodePool(projectID, zone, cluster, *from, spec); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-}
\ No newline at end of file
+	if err := cl.applyNodePool(projectID, zone, cluster, spec); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pondohva/golang-samples/gke/pricing"
+	"google.golang.org/api/container/v1"
+)
+
+// regionOf returns the region of a zone, e.g. us-central1 for us-central1-a
+func regionOf(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i > 0 {
+		return zone[:i]
+	}
+	return zone
+}
+
+// quotaNeeds returns how much of each regional quota metric adding nodes
+// built from the node config uses
+func (cl *client) quotaNeeds(projectID, zone string, config *container.NodeConfig, nodes int64) (map[string]float64, error) {
+	mt, err := cl.computeClient.MachineTypes.Get(projectID, zone, config.MachineType).Do()
+	if err != nil {
+		return nil, apiError(fmt.Sprintf("failed to get machine type %s", config.MachineType), err)
+	}
+
+	diskSize := config.DiskSizeGb
+	if diskSize == 0 {
+		diskSize = pricing.DefaultDiskSizeGb
+	}
+
+	needs := map[string]float64{
+		"INSTANCES":        float64(nodes),
+		"IN_USE_ADDRESSES": float64(nodes),
+	}
+
+	// SSD boot disks have a quota of their own
+	if config.DiskType == "pd-ssd" {
+		needs["SSD_TOTAL_GB"] = float64(nodes * diskSize)
+	} else {
+		needs["DISKS_TOTAL_GB"] = float64(nodes * diskSize)
+	}
+
+	if config.Preemptible {
+		needs["PREEMPTIBLE_CPUS"] = float64(nodes * mt.GuestCpus)
+	} else {
+		needs["CPUS"] = float64(nodes * mt.GuestCpus)
+	}
+
+	if config.LocalSsdCount > 0 {
+		needs["LOCAL_SSD_TOTAL_GB"] = float64(nodes * config.LocalSsdCount * pricing.LocalSsdSizeGb)
+	}
+
+	return needs, nil
+}
+
+// checkQuota refuses a change whose needs don't fit the free regional quota
+func (cl *client) checkQuota(projectID, zone string, needs map[string]float64) error {
+	region := regionOf(zone)
+
+	r, err := cl.computeClient.Regions.Get(projectID, region).Do()
+	if err != nil {
+		return apiError(fmt.Sprintf("failed to get region %s", region), err)
+	}
+
+	quotas := make(map[string]float64)
+	usage := make(map[string]float64)
+	for _, q := range r.Quotas {
+		quotas[q.Metric] = q.Limit
+		usage[q.Metric] = q.Usage
+	}
+
+	// Preemptible CPUs are counted against CPUS when the project has no
+	// dedicated preemptible quota
+	if n, ok := needs["PREEMPTIBLE_CPUS"]; ok && quotas["PREEMPTIBLE_CPUS"] == 0 {
+		delete(needs, "PREEMPTIBLE_CPUS")
+		needs["CPUS"] += n
+	}
+
+	metrics := make([]string, 0, len(needs))
+	for m := range needs {
+		metrics = append(metrics, m)
+	}
+	sort.Strings(metrics)
+
+	var exceeded []string
+	for _, m := range metrics {
+		limit, ok := quotas[m]
+		if !ok {
+			continue
+		}
+
+		fmt.Printf("quota %s in %s: usage %.0f + %.0f of %.0f\n", m, region, usage[m], needs[m], limit)
+
+		if usage[m]+needs[m] > limit {
+			exceeded = append(exceeded, fmt.Sprintf("%s: need %.0f more, only %.0f of %.0f free", m, needs[m], limit-usage[m], limit))
+		}
+	}
+
+	if len(exceeded) > 0 {
+		return fmt.Errorf("change would exceed quota in %s:\n\t%s", region, strings.Join(exceeded, "\n\t"))
+	}
+
+	return nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"time"
+
+	"google.golang.org/api/container/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// clusterManifest lists every node pool of a cluster, each in the format of
+// a --spec file:
+//
+//	cluster: prod
+//	nodePools:
+//	- name: default-pool
+//	  initialNodeCount: 3
+//	- name: batch
+//	  autoscaling: {min: 0, max: 20}
+//	  preemptible: true
+type clusterManifest struct {
+	Cluster   string          `yaml:"cluster"`
+	NodePools []*nodePoolSpec `yaml:"nodePools"`
+}
+
+func loadManifest(path string) (*clusterManifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var m clusterManifest
+	if err := yaml.UnmarshalStrict(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, spec := range m.NodePools {
+		if err := spec.validate(); err != nil {
+			return nil, fmt.Errorf("%s: nodePools[%d]: %v", path, i, err)
+		}
+		if seen[spec.Name] {
+			return nil, fmt.Errorf("%s: nodePools[%d]: duplicate node pool %s", path, i, spec.Name)
+		}
+		seen[spec.Name] = true
+	}
+
+	return &m, nil
+}
+
+// plan actions; recreate and unmanaged are only reported
+const (
+	actionCreate    = "create"
+	actionUpdate    = "update"
+	actionRecreate  = "recreate"
+	actionDelete    = "delete"
+	actionUnmanaged = "unmanaged"
+)
+
+type planAction struct {
+	Action   string   `yaml:"action"`
+	NodePool string   `yaml:"nodePool"`
+	Changes  []string `yaml:"changes,omitempty"`
+
+	spec  *nodePoolSpec
+	diffs []fieldDiff
+}
+
+// reconcilePlan is what reconcile will do to the cluster; plan saves it so it
+// can be reviewed before apply carries it out
+type reconcilePlan struct {
+	Cluster  string        `yaml:"cluster"`
+	Manifest string        `yaml:"manifest"`
+	Prune    bool          `yaml:"prune"`
+	Created  string        `yaml:"created"`
+	Actions  []*planAction `yaml:"actions"`
+}
+
+func (p *reconcilePlan) empty() bool {
+	for _, a := range p.Actions {
+		if a.Action == actionCreate || a.Action == actionUpdate || a.Action == actionDelete {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *reconcilePlan) print() {
+	fmt.Printf("Plan for cluster %s from %s:\n", p.Cluster, p.Manifest)
+	if len(p.Actions) == 0 {
+		fmt.Println("\tno changes")
+	}
+	for _, a := range p.Actions {
+		fmt.Printf("\t%s %s\n", a.Action, a.NodePool)
+		for _, c := range a.Changes {
+			fmt.Printf("\t\t%s\n", c)
+		}
+	}
+}
+
+// same reports whether both plans do the same to the same cluster
+func (p *reconcilePlan) same(o *reconcilePlan) bool {
+	if p.Cluster != o.Cluster || p.Prune != o.Prune || len(p.Actions) != len(o.Actions) {
+		return false
+	}
+	for i, a := range p.Actions {
+		b := o.Actions[i]
+		if a.Action != b.Action || a.NodePool != b.NodePool || !reflect.DeepEqual(a.Changes, b.Changes) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *reconcilePlan) save(path string) error {
+	data, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func loadPlan(path string) (*reconcilePlan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p reconcilePlan
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	return &p, nil
+}
+
+// planReconcile compares the manifest with the node pools of the cluster
+func (cl *client) planReconcile(projectID, zone string, cluster *container.Cluster, manifestPath string, m *clusterManifest, prune bool) (*reconcilePlan, error) {
+	p := &reconcilePlan{
+		Cluster:  cluster.Name,
+		Manifest: manifestPath,
+		Prune:    prune,
+		Created:  time.Now().UTC().Format(time.RFC3339),
+	}
+
+	existing := make(map[string]*container.NodePool)
+	for _, np := range cluster.NodePools {
+		existing[np.Name] = np
+	}
+
+	for _, spec := range m.NodePools {
+		current, ok := existing[spec.Name]
+		if !ok {
+			np := spec.nodePool()
+			p.Actions = append(p.Actions, &planAction{
+				Action:   actionCreate,
+				NodePool: spec.Name,
+				Changes:  []string{fmt.Sprintf("%d x %s, version %s", np.InitialNodeCount, np.Config.MachineType, np.Version)},
+				spec:     spec,
+			})
+			continue
+		}
+
+		diffs, err := cl.diffExisting(projectID, zone, cluster, current, spec)
+		if err != nil {
+			return nil, err
+		}
+
+		update := &planAction{Action: actionUpdate, NodePool: spec.Name, spec: spec}
+		recreate := &planAction{Action: actionRecreate, NodePool: spec.Name, spec: spec}
+		for _, d := range diffs {
+			a := recreate
+			if d.inPlace {
+				a = update
+			}
+			a.Changes = append(a.Changes, d.String())
+			a.diffs = append(a.diffs, d)
+		}
+
+		for _, a := range []*planAction{update, recreate} {
+			if len(a.diffs) > 0 {
+				p.Actions = append(p.Actions, a)
+			}
+		}
+	}
+
+	wanted := make(map[string]bool)
+	for _, spec := range m.NodePools {
+		wanted[spec.Name] = true
+	}
+	for _, np := range cluster.NodePools {
+		if wanted[np.Name] {
+			continue
+		}
+		if prune {
+			p.Actions = append(p.Actions, &planAction{
+				Action:   actionDelete,
+				NodePool: np.Name,
+				Changes:  []string{"not in the manifest, drained and deleted"},
+			})
+		} else {
+			p.Actions = append(p.Actions, &planAction{
+				Action:   actionUnmanaged,
+				NodePool: np.Name,
+				Changes:  []string{"not in the manifest, kept; --prune deletes it"},
+			})
+		}
+	}
+
+	return p, nil
+}
+
+// applyPlan carries out a plan computed against the cluster as it is now
+func (cl *client) applyPlan(projectID, zone string, cluster *container.Cluster, p *reconcilePlan) error {
+	for _, a := range p.Actions {
+		switch a.Action {
+		case actionCreate:
+			if err := cl.createNodePool(projectID, zone, cluster, a.spec); err != nil {
+				return err
+			}
+
+		case actionUpdate:
+			for _, d := range a.diffs {
+				if err := cl.updateField(projectID, zone, cluster, a.spec, d); err != nil {
+					return apiError(fmt.Sprintf("failed to update %s of node pool %s", d.field, a.NodePool), err)
+				}
+			}
+
+		case actionDelete:
+			if err := cl.deleteNodePool(projectID, zone, cluster, a.NodePool); err != nil {
+				return err
+			}
+
+		case actionRecreate:
+			fmt.Printf("Not changed, node pool %s has to be recreated (see update-nodepool migrate)\n", a.NodePool)
+		}
+	}
+
+	return nil
+}
+
+// deleteNodePool drains the node pool and deletes it
+func (cl *client) deleteNodePool(projectID, zone string, cluster *container.Cluster, nodePoolID string) error {
+	// confirm goes ahead without a terminal, deleting needs --yes then
+	if !*yes && !isTerminal() {
+		fmt.Printf("Skipping delete of %s, pass --yes to delete node pools without a terminal\n", nodePoolID)
+		return nil
+	}
+	if !confirm(fmt.Sprintf("Drain and delete node pool %s?", nodePoolID)) {
+		fmt.Printf("Skipping delete of %s\n", nodePoolID)
+		return nil
+	}
+
+	kc, err := NewKubeClientForCluster(projectID, zone, cluster)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+	if err := drainPool(kc, nodePoolID); err != nil {
+		return fmt.Errorf("failed to drain node pool %s, not deleted: %v", nodePoolID, err)
+	}
+
+	op, err := cl.containerClient.Projects.Zones.Clusters.NodePools.Delete(projectID, zone, cluster.Name, nodePoolID).Do()
+	if err != nil {
+		return apiError(fmt.Sprintf("failed to delete node pool %s", nodePoolID), err)
+	}
+
+	fmt.Printf("We're going to %s, status %s, id: %s\n", op.OperationType, op.Status, op.Name)
+
+	if _, err := followOperation(cl.containerClient, projectID, zone, op.Name, *timeout); err != nil && err != errDetached {
+		return err
+	}
+	return nil
+}
+
+// runReconcile is the reconcile command:
+//
+//	reconcile plan    saves the plan to --plan
+//	reconcile apply   carries out the saved plan if the cluster hasn't changed
+//	reconcile         plans and applies, every --interval when it is set
+func (cl *client) runReconcile(projectID, zone, sub string) error {
+	switch sub {
+	case "plan":
+		p, _, err := cl.reconcileOnce(projectID, zone, *manifestFile, *prune)
+		if err != nil {
+			return err
+		}
+		p.print()
+		if err := p.save(*planFile); err != nil {
+			return err
+		}
+		fmt.Printf("Plan saved to %s, carry it out with: reconcile apply\n", *planFile)
+		return nil
+
+	case "apply":
+		saved, err := loadPlan(*planFile)
+		if err != nil {
+			return err
+		}
+		p, cluster, err := cl.reconcileOnce(projectID, zone, saved.Manifest, saved.Prune)
+		if err != nil {
+			return err
+		}
+		if !p.same(saved) {
+			p.print()
+			return fmt.Errorf("the cluster or manifest changed since %s was planned at %s, plan again", *planFile, saved.Created)
+		}
+
+		p.print()
+		if err := cl.applyPlan(projectID, zone, cluster, p); err != nil {
+			return err
+		}
+		return os.Remove(*planFile)
+
+	case "":
+		for {
+			err := cl.reconcileAndApply(projectID, zone)
+			if *interval <= 0 {
+				return err
+			}
+			if err != nil {
+				log.Printf("Reconcile: %v", err)
+			}
+			time.Sleep(*interval)
+		}
+
+	default:
+		return errors.New("usage: reconcile [plan|apply]")
+	}
+}
+
+func (cl *client) reconcileAndApply(projectID, zone string) error {
+	p, cluster, err := cl.reconcileOnce(projectID, zone, *manifestFile, *prune)
+	if err != nil {
+		return err
+	}
+
+	p.print()
+	if p.empty() {
+		return nil
+	}
+	return cl.applyPlan(projectID, zone, cluster, p)
+}
+
+// reconcileOnce loads the manifest and plans against the cluster it names,
+// or GKE_CLUSTER_ID
+func (cl *client) reconcileOnce(projectID, zone, manifestPath string, prune bool) (*reconcilePlan, *container.Cluster, error) {
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clusterID := m.Cluster
+	if clusterID == "" {
+		clusterID = os.Getenv("GKE_CLUSTER_ID")
+	}
+	if clusterID == "" {
+		return nil, nil, fmt.Errorf("set cluster in %s or GKE_CLUSTER_ID", manifestPath)
+	}
+
+	cluster, err := cl.containerClient.Projects.Zones.Clusters.Get(projectID, zone, clusterID).Do()
+	if err != nil {
+		return nil, nil, apiError(fmt.Sprintf("failed to get cluster %s", clusterID), err)
+	}
+
+	p, err := cl.planReconcile(projectID, zone, cluster, manifestPath, m, prune)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, cluster, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"google.golang.org/api/container/v1"
+)
+
+func TestPlanReconcile(t *testing.T) {
+	cluster := &container.Cluster{
+		Name:                 "prod",
+		CurrentMasterVersion: "1.11.5-gke.5",
+		NodePools: []*container.NodePool{
+			{Name: "default-pool", Version: "1.11.5-gke.5", Config: &container.NodeConfig{MachineType: "n1-standard-1"}},
+			{Name: "batch", Version: "1.11.5-gke.5", Config: &container.NodeConfig{MachineType: "n1-standard-4"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		specs   []*nodePoolSpec
+		prune   bool
+		actions []string
+		empty   bool
+	}{
+		{
+			name: "converged at a version prefix",
+			specs: []*nodePoolSpec{
+				{Name: "default-pool", Version: "1.11"},
+				{Name: "batch", Version: "1.11", MachineType: "n1-standard-4"},
+			},
+			empty: true,
+		},
+		{
+			name: "converged at latest",
+			specs: []*nodePoolSpec{
+				{Name: "default-pool", Version: "latest"},
+				{Name: "batch", Version: "latest"},
+			},
+			empty: true,
+		},
+		{
+			name: "upgrade to another minor",
+			specs: []*nodePoolSpec{
+				{Name: "default-pool", Version: "1.12"},
+				{Name: "batch"},
+			},
+			actions: []string{"update default-pool"},
+		},
+		{
+			name:    "unmanaged pools are kept",
+			specs:   []*nodePoolSpec{{Name: "default-pool", Version: "1.11"}},
+			actions: []string{"unmanaged batch"},
+			empty:   true,
+		},
+		{
+			name:    "prune",
+			specs:   []*nodePoolSpec{{Name: "default-pool"}},
+			prune:   true,
+			actions: []string{"delete batch"},
+		},
+		{
+			name: "create and recreate",
+			specs: []*nodePoolSpec{
+				{Name: "default-pool", MachineType: "n1-standard-2"},
+				{Name: "batch"},
+				{Name: "web"},
+			},
+			actions: []string{"recreate default-pool", "create web"},
+		},
+	}
+
+	cl := &client{}
+	for _, tt := range tests {
+		m := &clusterManifest{Cluster: cluster.Name, NodePools: tt.specs}
+		p, err := cl.planReconcile("project", "europe-west1-b", cluster, "manifest.yaml", m, tt.prune)
+		if err != nil {
+			t.Errorf("%s: planReconcile() error = %v", tt.name, err)
+			continue
+		}
+
+		var actions []string
+		for _, a := range p.Actions {
+			actions = append(actions, a.Action+" "+a.NodePool)
+		}
+		if len(actions) != len(tt.actions) {
+			t.Errorf("%s: planReconcile() actions = %v, want %v", tt.name, actions, tt.actions)
+			continue
+		}
+		for i := range actions {
+			if actions[i] != tt.actions[i] {
+				t.Errorf("%s: planReconcile() actions = %v, want %v", tt.name, actions, tt.actions)
+				break
+			}
+		}
+		if p.empty() != tt.empty {
+			t.Errorf("%s: plan empty = %t, want %t", tt.name, p.empty(), tt.empty)
+		}
+
+		// --interval plans again against the same cluster
+		again, err := cl.planReconcile("project", "europe-west1-b", cluster, "manifest.yaml", m, tt.prune)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !p.same(again) {
+			t.Errorf("%s: planning twice gave different plans", tt.name)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/container/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// nodePoolSpec is the node pool described in a YAML or JSON file, e.g.
+//
+//	name: batch
+//	initialNodeCount: 3
+//	autoscaling: {min: 1, max: 10}
+//	management: {autoUpgrade: true, autoRepair: true}
+//	machineType: n1-highmem-4
+//	diskSizeGb: 200
+//	diskType: pd-ssd
+//	imageType: COS
+//	preemptible: true
+//	labels: {workload: batch}
+//	taints: [{key: dedicated, value: batch, effect: NoSchedule}]
+//	oauthScopes: [https://www.googleapis.com/auth/cloud-platform]
+//	nodeLocations: [europe-west1-b, europe-west1-c]
+//
+// Fields that aren't set keep GKE's defaults.
+type nodePoolSpec struct {
+	Name             string            `yaml:"name,omitempty"`
+	Version          string            `yaml:"version,omitempty"`
+	InitialNodeCount *int64            `yaml:"initialNodeCount,omitempty"`
+	Autoscaling      *autoscalingSpec  `yaml:"autoscaling,omitempty"`
+	Management       *managementSpec   `yaml:"management,omitempty"`
+	MachineType      string            `yaml:"machineType,omitempty"`
+	DiskSizeGb       int64             `yaml:"diskSizeGb,omitempty"`
+	DiskType         string            `yaml:"diskType,omitempty"`
+	ImageType        string            `yaml:"imageType,omitempty"`
+	Preemptible      bool              `yaml:"preemptible,omitempty"`
+	Labels           map[string]string `yaml:"labels,omitempty"`
+	Taints           []taintSpec       `yaml:"taints,omitempty"`
+	Metadata         map[string]string `yaml:"metadata,omitempty"`
+	OauthScopes      []string          `yaml:"oauthScopes,omitempty"`
+	ServiceAccount   string            `yaml:"serviceAccount,omitempty"`
+	LocalSsdCount    int64             `yaml:"localSsdCount,omitempty"`
+	Tags             []string          `yaml:"tags,omitempty"`
+	NodeLocations    []string          `yaml:"nodeLocations,omitempty"`
+	Accelerators     []acceleratorSpec `yaml:"accelerators,omitempty"`
+	MinCpuPlatform   string            `yaml:"minCpuPlatform,omitempty"`
+}
+
+type acceleratorSpec struct {
+	Type  string `yaml:"type,omitempty"`
+	Count int64  `yaml:"count,omitempty"`
+}
+
+type autoscalingSpec struct {
+	Min int64 `yaml:"min,omitempty"`
+	Max int64 `yaml:"max,omitempty"`
+}
+
+type managementSpec struct {
+	AutoUpgrade bool `yaml:"autoUpgrade,omitempty"`
+	AutoRepair  bool `yaml:"autoRepair,omitempty"`
+}
+
+type taintSpec struct {
+	Key    string `yaml:"key,omitempty"`
+	Value  string `yaml:"value,omitempty"`
+	Effect string `yaml:"effect,omitempty"`
+}
+
+// taintEffects maps the Kubernetes taint effects to those of the API
+var taintEffects = map[string]string{
+	"NoSchedule":       "NO_SCHEDULE",
+	"PreferNoSchedule": "PREFER_NO_SCHEDULE",
+	"NoExecute":        "NO_EXECUTE",
+}
+
+var (
+	nodePoolName = regexp.MustCompile(`^[a-z]([-a-z0-9]{0,38}[a-z0-9])?$`)
+	labelKey     = regexp.MustCompile(`^([a-z0-9]([-a-z0-9.]*[a-z0-9])?/)?[A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?$`)
+	labelValue   = regexp.MustCompile(`^([A-Za-z0-9]([-A-Za-z0-9_.]{0,61}[A-Za-z0-9])?)?$`)
+)
+
+// loadSpec reads a spec file; YAML is a superset of JSON so both parse.
+// Unknown fields are errors, to catch typos.
+func loadSpec(path string) (*nodePoolSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec nodePoolSpec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	return &spec, nil
+}
+
+// specErrors collects field-level validation errors
+type specErrors []string
+
+func (e *specErrors) add(field, format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+func (e specErrors) Error() string {
+	return "invalid node pool spec:\n\t" + strings.Join(e, "\n\t")
+}
+
+// validate checks the spec before it is sent to the API
+func (s *nodePoolSpec) validate() error {
+	var errs specErrors
+
+	if !nodePoolName.MatchString(s.Name) {
+		errs.add("name", "%q must be 1-40 lowercase letters, digits or dashes, starting with a letter", s.Name)
+	}
+
+	if n := s.InitialNodeCount; n != nil && *n < 0 {
+		errs.add("initialNodeCount", "%d must not be negative", *n)
+	}
+	if n := s.InitialNodeCount; n != nil && *n == 0 && s.Autoscaling == nil {
+		errs.add("initialNodeCount", "must be at least 1 without autoscaling")
+	}
+
+	if a := s.Autoscaling; a != nil {
+		if a.Min < 0 {
+			errs.add("autoscaling.min", "%d must not be negative", a.Min)
+		}
+		if a.Max < 1 {
+			errs.add("autoscaling.max", "%d must be at least 1", a.Max)
+		}
+		if a.Max < a.Min {
+			errs.add("autoscaling.max", "%d is less than min %d", a.Max, a.Min)
+		}
+		if n := s.InitialNodeCount; n != nil && (*n < a.Min || *n > a.Max) {
+			errs.add("initialNodeCount", "%d is outside autoscaling min %d and max %d", *n, a.Min, a.Max)
+		}
+	}
+
+	if s.DiskSizeGb != 0 && s.DiskSizeGb < 10 {
+		errs.add("diskSizeGb", "%d is less than the minimum of 10", s.DiskSizeGb)
+	}
+	switch s.DiskType {
+	case "", "pd-standard", "pd-ssd":
+	default:
+		errs.add("diskType", "%q must be pd-standard or pd-ssd", s.DiskType)
+	}
+	if s.LocalSsdCount < 0 {
+		errs.add("localSsdCount", "%d must not be negative", s.LocalSsdCount)
+	}
+
+	for k, v := range s.Labels {
+		if !labelKey.MatchString(k) {
+			errs.add("labels", "key %q is not a valid label key", k)
+		}
+		if !labelValue.MatchString(v) {
+			errs.add("labels."+k, "%q is not a valid label value", v)
+		}
+	}
+
+	for i, t := range s.Taints {
+		field := fmt.Sprintf("taints[%d]", i)
+		if !labelKey.MatchString(t.Key) {
+			errs.add(field+".key", "%q is not a valid taint key", t.Key)
+		}
+		if !labelValue.MatchString(t.Value) {
+			errs.add(field+".value", "%q is not a valid taint value", t.Value)
+		}
+		if _, ok := taintEffects[t.Effect]; !ok {
+			errs.add(field+".effect", "%q must be NoSchedule, PreferNoSchedule or NoExecute", t.Effect)
+		}
+	}
+
+	for k := range s.Metadata {
+		if k == "" {
+			errs.add("metadata", "keys must not be empty")
+		}
+	}
+
+	for i, scope := range s.OauthScopes {
+		if !strings.HasPrefix(scope, "https://www.googleapis.com/auth/") {
+			errs.add(fmt.Sprintf("oauthScopes[%d]", i), "%q is not a https://www.googleapis.com/auth/ scope URL", scope)
+		}
+	}
+
+	if s.ServiceAccount != "" && s.ServiceAccount != "default" && !strings.Contains(s.ServiceAccount, "@") {
+		errs.add("serviceAccount", "%q must be \"default\" or a service account email", s.ServiceAccount)
+	}
+
+	for i, a := range s.Accelerators {
+		field := fmt.Sprintf("accelerators[%d]", i)
+		if a.Type == "" {
+			errs.add(field+".type", "must be set, e.g. nvidia-tesla-k80")
+		}
+		if a.Count < 1 {
+			errs.add(field+".count", "%d must be at least 1", a.Count)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, l := range s.NodeLocations {
+		if strings.Count(l, "-") != 2 {
+			errs.add(fmt.Sprintf("nodeLocations[%d]", i), "%q is not a zone, e.g. europe-west1-b", l)
+		}
+		if seen[l] {
+			errs.add(fmt.Sprintf("nodeLocations[%d]", i), "%s is listed twice", l)
+		}
+		seen[l] = true
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// nodePool returns the node pool to create. The vendored container/v1 client
+// has no NodePool.Locations, createNodePool sends the node locations.
+func (s *nodePoolSpec) nodePool() *container.NodePool {
+	np := &container.NodePool{
+		Name:             s.Name,
+		InitialNodeCount: 1,
+		Version:          s.Version,
+		Config: &container.NodeConfig{
+			MachineType:    s.MachineType,
+			DiskSizeGb:     s.DiskSizeGb,
+			DiskType:       s.DiskType,
+			ImageType:      s.ImageType,
+			Preemptible:    s.Preemptible,
+			Labels:         s.Labels,
+			Metadata:       s.Metadata,
+			OauthScopes:    s.OauthScopes,
+			ServiceAccount: s.ServiceAccount,
+			LocalSsdCount:  s.LocalSsdCount,
+			Tags:           s.Tags,
+			MinCpuPlatform: s.MinCpuPlatform,
+		},
+	}
+
+	for _, t := range s.Taints {
+		np.Config.Taints = append(np.Config.Taints, &container.NodeTaint{
+			Key:    t.Key,
+			Value:  t.Value,
+			Effect: taintEffects[t.Effect],
+		})
+	}
+	for _, a := range s.Accelerators {
+		np.Config.Accelerators = append(np.Config.Accelerators, &container.AcceleratorConfig{
+			AcceleratorType:  a.Type,
+			AcceleratorCount: a.Count,
+		})
+	}
+
+	if np.Version == "" {
+		np.Version = "latest"
+	}
+	if np.Config.MachineType == "" {
+		np.Config.MachineType = defaultMachineType
+	}
+	if s.InitialNodeCount != nil {
+		np.InitialNodeCount = *s.InitialNodeCount
+	}
+	if a := s.Autoscaling; a != nil {
+		np.Autoscaling = &container.NodePoolAutoscaling{
+			Enabled:      true,
+			MinNodeCount: a.Min,
+			MaxNodeCount: a.Max,
+		}
+		if s.InitialNodeCount == nil && a.Min > np.InitialNodeCount {
+			np.InitialNodeCount = a.Min
+		}
+	}
+	if m := s.Management; m != nil {
+		np.Management = &container.NodeManagement{
+			AutoUpgrade: m.AutoUpgrade,
+			AutoRepair:  m.AutoRepair,
+		}
+	}
+
+	return np
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// address types --type selects
+const (
+	typeInternal = "internal"
+	typeExternal = "external"
+	typeIPv6     = "ipv6"
+	typeDNS      = "dns"
+)
+
+// nodeAddress is an address of the node and where it was found
+type nodeAddress struct {
+	Address string `json:"address"`
+	Type    string `json:"type"`
+	// Source is metadata, compute or kubernetes
+	Source string `json:"source"`
+	// Field is where in the source the address is
+	Field string `json:"field"`
+}
+
+// newAddress types IPv6 addresses as ipv6 whatever the source calls them
+func newAddress(address, addrType, source, field string) nodeAddress {
+	ip := address
+	if i := strings.Index(ip, "/"); i >= 0 {
+		ip = ip[:i]
+	}
+	if p := net.ParseIP(ip); p != nil && p.To4() == nil {
+		addrType = typeIPv6
+	}
+	return nodeAddress{address, addrType, source, field}
+}
+
+func addressesFromMetadata(endpoint, hostname string, timeout time.Duration) ([]nodeAddress, error) {
+	if err := checkMetadataInstance(endpoint, hostname, timeout); err != nil {
+		return nil, err
+	}
+
+	var nics []metadataInterface
+	if err := getMetadata(endpoint, "instance/network-interfaces/?recursive=true", timeout, &nics); err != nil {
+		return nil, err
+	}
+
+	var addrs []nodeAddress
+	for i, ni := range nics {
+		nic := fmt.Sprintf("network-interfaces/%d", i)
+		if ni.IP != "" {
+			addrs = append(addrs, newAddress(ni.IP, typeInternal, "metadata", nic+"/ip"))
+		}
+		for j, r := range ni.IPAliases {
+			addrs = append(addrs, newAddress(r, typeInternal, "metadata", fmt.Sprintf("%s/ip-aliases/%d", nic, j)))
+		}
+		for j, ip := range ni.IPv6s {
+			addrs = append(addrs, newAddress(ip, typeIPv6, "metadata", fmt.Sprintf("%s/ipv6s/%d", nic, j)))
+		}
+		for j, ac := range ni.AccessConfigs {
+			field := fmt.Sprintf("%s/access-configs/%d", nic, j)
+			if ac.ExternalIP != "" {
+				addrs = append(addrs, newAddress(ac.ExternalIP, typeExternal, "metadata", field+"/external-ip"))
+			}
+			if ac.ExternalIPv6 != "" {
+				addrs = append(addrs, newAddress(ac.ExternalIPv6, typeIPv6, "metadata", field+"/external-ipv6"))
+			}
+		}
+	}
+
+	return addrs, nil
+}
+
+// addressesFromGCP lists every NIC of the instance. The compute/v1 API this
+// is built with has no IPv6 access configs, those come from the metadata
+// server or Kubernetes.
+func (cl *client) addressesFromGCP(hostname string) ([]nodeAddress, error) {
+	instance, err := cl.computeClient.Instances.Get(cl.projectID, cl.zone, hostname).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []nodeAddress
+	for _, ni := range instance.NetworkInterfaces {
+		if ni.NetworkIP != "" {
+			addrs = append(addrs, newAddress(ni.NetworkIP, typeInternal, "compute", ni.Name+".networkIP"))
+		}
+		for i, r := range ni.AliasIpRanges {
+			addrs = append(addrs, newAddress(r.IpCidrRange, typeInternal, "compute", fmt.Sprintf("%s.aliasIpRanges[%d]", ni.Name, i)))
+		}
+		for i, ac := range ni.AccessConfigs {
+			if ac.NatIP != "" {
+				addrs = append(addrs, newAddress(ac.NatIP, typeExternal, "compute", fmt.Sprintf("%s.accessConfigs[%d].natIP", ni.Name, i)))
+			}
+		}
+	}
+
+	return addrs, nil
+}
+
+func (cl *client) addressesFromKube(hostname string) ([]nodeAddress, error) {
+	node, err := cl.kubeClient.CoreV1().Nodes().Get(hostname, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []nodeAddress
+	for _, a := range node.Status.Addresses {
+		t := typeDNS
+		switch a.Type {
+		case v1.NodeInternalIP:
+			t = typeInternal
+		case v1.NodeExternalIP:
+			t = typeExternal
+		}
+		addrs = append(addrs, newAddress(a.Address, t, "kubernetes", "status.addresses["+string(a.Type)+"]"))
+	}
+
+	return addrs, nil
+}
+
+// allAddresses collects the addresses from every source that answers
+func allAddresses(hostname string) ([]nodeAddress, error) {
+	var addrs []nodeAddress
+
+	md, err := addressesFromMetadata(*metadataEndpoint, hostname, *metadataTimeout)
+	if err != nil {
+		log.Println(fmt.Errorf("failed to get addresses from the metadata server: %+v", err))
+	}
+	addrs = append(addrs, md...)
+
+	// a client that can't be built is a source that failed, the metadata
+	// server may still have answered
+	if cl, err := clientFromEnv(context.Background()); err != nil {
+		log.Println(fmt.Errorf("failed to create the GCP and Kubernetes clients: %+v", err))
+	} else {
+		gcp, err := cl.addressesFromGCP(hostname)
+		if err != nil {
+			log.Println(fmt.Errorf("failed to get addresses from GCP: %+v", err))
+		}
+		addrs = append(addrs, gcp...)
+
+		kube, err := cl.addressesFromKube(hostname)
+		if err != nil {
+			log.Println(fmt.Errorf("failed to get addresses from Kubernetes: %+v", err))
+		}
+		addrs = append(addrs, kube...)
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", hostname)
+	}
+	return addrs, nil
+}
+
+func filterAddresses(addrs []nodeAddress, addrType string) []nodeAddress {
+	if addrType == "" {
+		return addrs
+	}
+
+	var out []nodeAddress
+	for _, a := range addrs {
+		if a.Type == addrType {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+// printAddresses prints the addresses of --type as JSON with --all, otherwise
+// the first one
+func printAddresses(hostname string) error {
+	switch *addrType {
+	case "", typeInternal, typeExternal, typeIPv6, typeDNS:
+	default:
+		return fmt.Errorf("--type must be %s, %s, %s or %s", typeInternal, typeExternal, typeIPv6, typeDNS)
+	}
+
+	addrs, err := allAddresses(hostname)
+	if err != nil {
+		return err
+	}
+	addrs = filterAddresses(addrs, *addrType)
+
+	if !*all {
+		if len(addrs) == 0 {
+			return fmt.Errorf("node doesn't have any %s address", *addrType)
+		}
+		fmt.Println(addrs[0].Address)
+		return nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(addrs)
+}
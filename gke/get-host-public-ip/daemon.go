@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// daemonNodeName is the node the daemon runs on: NODE_NAME set from the
+// downward API (fieldRef spec.nodeName), or HOSTNAME of a hostNetwork pod
+func daemonNodeName() (string, error) {
+	if name := os.Getenv("NODE_NAME"); name != "" {
+		return name, nil
+	}
+	if name := os.Getenv("HOSTNAME"); name != "" {
+		return name, nil
+	}
+	return "", fmt.Errorf("set NODE_NAME from the downward API or HOSTNAME")
+}
+
+// daemonLocation is the project and zone of the node the daemon runs on, from
+// the metadata server: the nodes of a DaemonSet can be in several zones.
+// GKE_PROJECT_ID and GKE_ZONE override it.
+func daemonLocation() (projectID, zone string, err error) {
+	projectID, zone = os.Getenv("GKE_PROJECT_ID"), os.Getenv("GKE_ZONE")
+	if projectID != "" && zone != "" {
+		return projectID, zone, nil
+	}
+
+	mdProject, mdZone, err := metadataLocation(*metadataEndpoint, *metadataTimeout)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get the project and zone from the metadata server, set GKE_PROJECT_ID and GKE_ZONE: %v", err)
+	}
+	if projectID == "" {
+		projectID = mdProject
+	}
+	if zone == "" {
+		zone = mdZone
+	}
+	return projectID, zone, nil
+}
+
+// runDaemon is the daemon command, meant for a DaemonSet: it publishes the
+// external IP of its node to --annotation on the Node and to --ip-file, and
+// checks again every --interval so a new IP is republished
+func runDaemon() error {
+	nodeName, err := daemonNodeName()
+	if err != nil {
+		return err
+	}
+
+	projectID, zone, err := daemonLocation()
+	if err != nil {
+		return err
+	}
+	cl, err := newClientIn(context.Background(), projectID, zone)
+	if err != nil {
+		return err
+	}
+	published := ""
+	first := true
+
+	for {
+		ip, err := cl.resolveNodeIP(nodeName)
+		if err != nil {
+			log.Printf("Failed to get the IP of %s: %v", nodeName, err)
+		} else if first || ip != published {
+			if err := cl.publishNodeIP(nodeName, ip); err != nil {
+				log.Printf("Failed to publish the IP of %s: %v", nodeName, err)
+			} else {
+				log.Printf("Published external IP %q of %s", ip, nodeName)
+				published = ip
+				first = false
+			}
+		}
+
+		time.Sleep(*interval)
+	}
+}
+
+// resolveNodeIP returns the external IP of the node, "" when it has none
+func (cl *client) resolveNodeIP(nodeName string) (string, error) {
+	ip, exists, err := getNodeIPFromMetadata(*metadataEndpoint, nodeName, *metadataTimeout)
+	if err != nil {
+		ip, exists, err = cl.GetNodeIP(nodeName)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", nil
+	}
+	return ip, nil
+}
+
+// publishNodeIP writes the IP to the node annotation and the file; a node
+// without an external IP loses both so nobody uses a stale one
+func (cl *client) publishNodeIP(nodeName, ip string) error {
+	var value interface{} = ip
+	if ip == "" {
+		value = nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{*annotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := cl.kubeClient.CoreV1().Nodes().Patch(nodeName, types.MergePatchType, patch); err != nil {
+		return fmt.Errorf("failed to annotate node %s: %v", nodeName, err)
+	}
+
+	if *ipFile == "" {
+		return nil
+	}
+	if ip == "" {
+		if err := os.Remove(*ipFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(*ipFile), 0755); err != nil {
+		return err
+	}
+	tmp := *ipFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(ip+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, *ipFile)
+}
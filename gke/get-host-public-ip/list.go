@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	compute "google.golang.org/api/compute/v1"
+	container "google.golang.org/api/container/v1"
+)
+
+// listedNode is a node of the cluster and its addresses
+type listedNode struct {
+	Name       string `json:"name"`
+	Zone       string `json:"zone"`
+	NodePool   string `json:"nodePool"`
+	InternalIP string `json:"internalIP"`
+	ExternalIP string `json:"externalIP"`
+}
+
+// poolPrefixes maps the instance name prefix of each node pool to the pool.
+// GKE names instances after the instance group manager, without -grp.
+func poolPrefixes(cluster *container.Cluster, nodePoolID string) map[string]string {
+	prefixes := make(map[string]string)
+	for _, np := range cluster.NodePools {
+		if nodePoolID != "" && np.Name != nodePoolID {
+			continue
+		}
+		for _, url := range np.InstanceGroupUrls {
+			name := url[strings.LastIndex(url, "/")+1:]
+			prefixes[strings.TrimSuffix(name, "-grp")] = np.Name
+		}
+	}
+	return prefixes
+}
+
+// instanceFilter is the list filter matching the instances of the prefixes
+func instanceFilter(prefixes map[string]string) string {
+	alts := make([]string, 0, len(prefixes))
+	for p := range prefixes {
+		alts = append(alts, p+"-.*")
+	}
+	sort.Strings(alts)
+	return fmt.Sprintf("name eq (%s)", strings.Join(alts, "|"))
+}
+
+// poolOf returns the node pool of an instance, "" when no prefix matches
+func poolOf(name string, prefixes map[string]string) string {
+	for p, pool := range prefixes {
+		if strings.HasPrefix(name, p+"-") {
+			return pool
+		}
+	}
+	return ""
+}
+
+// listNodes resolves the addresses of every node of the cluster, or of the
+// node pool, with one filtered list call instead of a Get per node
+func (cl *client) listNodes(clusterID, nodePoolID string) ([]listedNode, error) {
+	cluster, err := cl.containerClient.Projects.Zones.Clusters.Get(cl.projectID, cl.zone, clusterID).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cluster %s: %v", clusterID, err)
+	}
+
+	prefixes := poolPrefixes(cluster, nodePoolID)
+	if len(prefixes) == 0 {
+		return nil, fmt.Errorf("no node pool %q in cluster %s", nodePoolID, clusterID)
+	}
+
+	filter := instanceFilter(prefixes)
+
+	var instances []*compute.Instance
+	ctx := context.Background()
+
+	// nodes of multi-zone clusters are spread over the zones of the cluster
+	if len(cluster.Locations) > 1 {
+		err = cl.computeClient.Instances.AggregatedList(cl.projectID).Filter(filter).Pages(ctx, func(l *compute.InstanceAggregatedList) error {
+			for _, scoped := range l.Items {
+				instances = append(instances, scoped.Instances...)
+			}
+			return nil
+		})
+	} else {
+		err = cl.computeClient.Instances.List(cl.projectID, cl.zone).Filter(filter).Pages(ctx, func(l *compute.InstanceList) error {
+			instances = append(instances, l.Items...)
+			return nil
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %v", err)
+	}
+
+	nodes := make([]listedNode, 0, len(instances))
+	for _, in := range instances {
+		n := listedNode{
+			Name:     in.Name,
+			Zone:     in.Zone[strings.LastIndex(in.Zone, "/")+1:],
+			NodePool: poolOf(in.Name, prefixes),
+		}
+		for _, ni := range in.NetworkInterfaces {
+			if n.InternalIP == "" {
+				n.InternalIP = ni.NetworkIP
+			}
+			for _, ac := range ni.AccessConfigs {
+				if n.ExternalIP == "" && ac.NatIP != "" {
+					n.ExternalIP = ac.NatIP
+				}
+			}
+		}
+		nodes = append(nodes, n)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Name < nodes[j].Name })
+	return nodes, nil
+}
+
+// printNodes writes the nodes to out as a table, JSON, CSV or the CIDR list of
+// their external IPs for firewall allowlists
+func printNodes(out io.Writer, nodes []listedNode, output string) error {
+	switch output {
+	case "table":
+		w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tZONE\tNODE POOL\tINTERNAL IP\tEXTERNAL IP")
+		for _, n := range nodes {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", n.Name, n.Zone, n.NodePool, n.InternalIP, n.ExternalIP)
+		}
+		return w.Flush()
+
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(nodes)
+
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"name", "zone", "nodePool", "internalIP", "externalIP"})
+		for _, n := range nodes {
+			w.Write([]string{n.Name, n.Zone, n.NodePool, n.InternalIP, n.ExternalIP})
+		}
+		w.Flush()
+		return w.Error()
+
+	case "cidr":
+		seen := make(map[string]bool)
+		var cidrs []string
+		for _, n := range nodes {
+			if n.ExternalIP != "" && !seen[n.ExternalIP] {
+				seen[n.ExternalIP] = true
+				cidrs = append(cidrs, n.ExternalIP+"/32")
+			}
+		}
+		sort.Strings(cidrs)
+		for _, c := range cidrs {
+			fmt.Fprintln(out, c)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("--output must be table, json, csv or cidr")
+}
+
+// runList is the list command
+func runList() error {
+	switch *output {
+	case "table", "json", "csv", "cidr":
+	default:
+		return fmt.Errorf("--output must be table, json, csv or cidr")
+	}
+
+	clusterID, ok := os.LookupEnv("GKE_CLUSTER_ID")
+	if !ok {
+		return fmt.Errorf("set GKE_CLUSTER_ID")
+	}
+
+	cl := newClient(context.Background())
+	nodes, err := cl.listNodes(clusterID, os.Getenv("GKE_NODE_POOL_ID"))
+	if err != nil {
+		return err
+	}
+	return printNodes(os.Stdout, nodes, *output)
+}
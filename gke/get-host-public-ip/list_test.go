@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	container "google.golang.org/api/container/v1"
+)
+
+func TestPoolPrefixes(t *testing.T) {
+	cluster := &container.Cluster{
+		Name: "prod",
+		NodePools: []*container.NodePool{
+			{Name: "default", InstanceGroupUrls: []string{
+				"https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instanceGroupManagers/gke-prod-default-1a2b3c4d-grp",
+			}},
+			{Name: "default-pool", InstanceGroupUrls: []string{
+				"https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-b/instanceGroupManagers/gke-prod-default-pool-5e6f7a8b-grp",
+				"https://www.googleapis.com/compute/v1/projects/my-project/zones/europe-west1-c/instanceGroupManagers/gke-prod-default-pool-9c0d1e2f-grp",
+			}},
+		},
+	}
+
+	tests := []struct {
+		nodePoolID string
+		want       map[string]string
+	}{
+		{"", map[string]string{
+			"gke-prod-default-1a2b3c4d":      "default",
+			"gke-prod-default-pool-5e6f7a8b": "default-pool",
+			"gke-prod-default-pool-9c0d1e2f": "default-pool",
+		}},
+		{"default", map[string]string{
+			"gke-prod-default-1a2b3c4d": "default",
+		}},
+		{"batch", map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		if got := poolPrefixes(cluster, tt.nodePoolID); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("poolPrefixes(%q) = %v, want %v", tt.nodePoolID, got, tt.want)
+		}
+	}
+
+	prefixes := poolPrefixes(cluster, "")
+
+	wantFilter := "name eq (gke-prod-default-1a2b3c4d-.*|gke-prod-default-pool-5e6f7a8b-.*|gke-prod-default-pool-9c0d1e2f-.*)"
+	if got := instanceFilter(prefixes); got != wantFilter {
+		t.Errorf("instanceFilter() = %s, want %s", got, wantFilter)
+	}
+
+	pools := []struct {
+		instance, pool string
+	}{
+		{"gke-prod-default-1a2b3c4d-x1y2", "default"},
+		{"gke-prod-default-pool-5e6f7a8b-x1y2", "default-pool"},
+		{"gke-prod-default-pool-9c0d1e2f-x1y2", "default-pool"},
+		{"gke-prod-default-pool-00000000-x1y2", ""},
+		{"gke-prod-default-1a2b3c4d", ""},
+		{"bastion", ""},
+	}
+	for _, tt := range pools {
+		if got := poolOf(tt.instance, prefixes); got != tt.pool {
+			t.Errorf("poolOf(%s) = %q, want %q", tt.instance, got, tt.pool)
+		}
+	}
+}
+
+func TestPrintNodes(t *testing.T) {
+	nodes := []listedNode{
+		{Name: "gke-prod-default-pool-5e6f7a8b-a", Zone: "europe-west1-b", NodePool: "default-pool", InternalIP: "10.132.0.2", ExternalIP: "35.195.9.9"},
+		{Name: "gke-prod-default-pool-5e6f7a8b-b", Zone: "europe-west1-b", NodePool: "default-pool", InternalIP: "10.132.0.3"},
+		{Name: "gke-prod-default-pool-9c0d1e2f-c", Zone: "europe-west1-c", NodePool: "default-pool", InternalIP: "10.132.0.4", ExternalIP: "35.195.1.1"},
+		{Name: "gke-prod-default-pool-9c0d1e2f-d", Zone: "europe-west1-c", NodePool: "default-pool", InternalIP: "10.132.0.5", ExternalIP: "35.195.9.9"},
+	}
+
+	tests := []struct {
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{
+			output: "csv",
+			want: "name,zone,nodePool,internalIP,externalIP\n" +
+				"gke-prod-default-pool-5e6f7a8b-a,europe-west1-b,default-pool,10.132.0.2,35.195.9.9\n" +
+				"gke-prod-default-pool-5e6f7a8b-b,europe-west1-b,default-pool,10.132.0.3,\n" +
+				"gke-prod-default-pool-9c0d1e2f-c,europe-west1-c,default-pool,10.132.0.4,35.195.1.1\n" +
+				"gke-prod-default-pool-9c0d1e2f-d,europe-west1-c,default-pool,10.132.0.5,35.195.9.9\n",
+		},
+		{
+			// a shared IP is listed once, nodes without one not at all
+			output: "cidr",
+			want:   "35.195.1.1/32\n35.195.9.9/32\n",
+		},
+		{
+			output:  "yaml",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		err := printNodes(&buf, nodes, tt.output)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("printNodes(%s) error = %v, wantErr %t", tt.output, err, tt.wantErr)
+			continue
+		}
+		if got := buf.String(); got != tt.want {
+			t.Errorf("printNodes(%s) =\n%s\nwant\n%s", tt.output, got, tt.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := printNodes(&buf, nil, "cidr"); err != nil || buf.Len() != 0 {
+		t.Errorf("printNodes(cidr) of no nodes = %q, %v, want nothing", buf.String(), err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 
 	"golang.org/x/oauth2/google"
 	compute "google.golang.org/api/compute/v1"
@@ -19,6 +20,19 @@ import (
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+var (
+	kubeconfig       = flag.String("kubeconfig", defaultKubeconfig(), "absolute path to the kubeconfig file")
+	metadataEndpoint = flag.String("metadata-endpoint", "http://metadata.google.internal/computeMetadata/v1", "GCE metadata server, tried before the APIs")
+	metadataTimeout  = flag.Duration("metadata-timeout", 2*time.Second, "how long to wait for the metadata server")
+	all              = flag.Bool("all", false, "print every address of the node as JSON with its source")
+	addrType         = flag.String("type", "", "only addresses of this type: internal, external, ipv6 or dns")
+
+	annotation = flag.String("annotation", "external-ip", "daemon: Node annotation the external IP is published to")
+	ipFile     = flag.String("ip-file", "/var/run/external-ip/ip", "daemon: file the external IP is written to, empty for none")
+	interval   = flag.Duration("interval", 5*time.Minute, "daemon: how often to check the IP again")
+	output     = flag.String("output", "table", "list: table, json, csv or cidr")
+)
+
 type client struct {
 	computeClient   *compute.Service
 	containerClient *container.Service
@@ -27,17 +41,43 @@ type client struct {
 	zone            string
 }
 
+// newClient is clientFromEnv for commands that can't go on without the APIs
 func newClient(ctx context.Context) *client {
+	cl, err := clientFromEnv(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return cl
+}
+
+// clientFromEnv returns a client for the instances of GKE_PROJECT_ID in
+// GKE_ZONE
+func clientFromEnv(ctx context.Context) (*client, error) {
+	projectID, ok := os.LookupEnv("GKE_PROJECT_ID")
+	if !ok {
+		return nil, fmt.Errorf("set GKE_PROJECT_ID")
+	}
+	zone, ok := os.LookupEnv("GKE_ZONE")
+	if !ok {
+		return nil, fmt.Errorf("set GKE_ZONE")
+	}
 
+	return newClientIn(ctx, projectID, zone)
+}
+
+// newClientIn returns a client for the instances of the project in the zone
+func newClientIn(ctx context.Context, projectID, zone string) (*client, error) {
 	hc, err := google.DefaultClient(ctx, container.CloudPlatformScope)
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 	containerSvc, err := container.New(hc)
+	if err != nil {
+		return nil, err
+	}
 	computeSvc, err := compute.New(hc)
-
 	if err != nil {
-		log.Panic(err)
+		return nil, err
 	}
 
 	config, err := getConfigInCluster()
@@ -45,23 +85,14 @@ func newClient(ctx context.Context) *client {
 	if err != nil {
 		config, err = getConfigOutOfCluster()
 		if err != nil {
-			panic(err.Error())
+			return nil, err
 		}
 	}
 
 	k8sClient, err := kubernetes.NewForConfig(config)
 
 	if err != nil {
-		log.Fatal(err.Error())
-	}
-
-	projectID, ok := os.LookupEnv("GKE_PROJECT_ID")
-	if !ok {
-		log.Fatal("set GKE_PROJECT_ID")
-	}
-	zone, ok := os.LookupEnv("GKE_ZONE")
-	if !ok {
-		log.Fatal("set GKE_ZONE")
+		return nil, err
 	}
 
 	return &client{
@@ -70,7 +101,7 @@ func newClient(ctx context.Context) *client {
 		kubeClient:      k8sClient,
 		projectID:       projectID,
 		zone:            zone,
-	}
+	}, nil
 }
 
 // GetNodeIPFromGCP returns external IP from GCP or Kubernetes API
@@ -107,7 +138,7 @@ func (cl *client) getNodeIPFromKube(hostname string, ipType v1.NodeAddressType)
 	node, err := cl.kubeClient.CoreV1().Nodes().Get(hostname, metav1.GetOptions{})
 
 	if err != nil {
-		log.Fatal(err.Error())
+		return "", err
 	}
 
 	for _, a := range node.Status.Addresses {
@@ -129,14 +160,6 @@ func getConfigInCluster() (*restclient.Config, error) {
 }
 
 func getConfigOutOfCluster() (*restclient.Config, error) {
-	var kubeconfig *string
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
 	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
 	if err != nil {
 		return nil, err
@@ -145,9 +168,30 @@ func getConfigOutOfCluster() (*restclient.Config, error) {
 	return config, nil
 }
 
+func defaultKubeconfig() string {
+	if home := homeDir(); home != "" {
+		return filepath.Join(home, ".kube", "config")
+	}
+	return ""
+}
+
 func main() {
+	flag.Parse()
 	ctx := context.Background()
-	cl := newClient(ctx)
+
+	if flag.Arg(0) == "list" {
+		if err := runList(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "daemon" {
+		if err := runDaemon(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	hostname, ok := os.LookupEnv("HOSTNAME")
 
@@ -155,7 +199,20 @@ func main() {
 		log.Fatal("set HOSTNAME")
 	}
 
-	externalAddress, exists, err := cl.GetNodeIP(hostname)
+	if *all || *addrType != "" {
+		if err := printAddresses(hostname); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// on GCE the metadata server knows the IP without any credentials
+	externalAddress, exists, err := getNodeIPFromMetadata(*metadataEndpoint, hostname, *metadataTimeout)
+	if err != nil {
+		log.Println(fmt.Errorf("failed to get ip from the metadata server: %+v", err))
+		cl := newClient(ctx)
+		externalAddress, exists, err = cl.GetNodeIP(hostname)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
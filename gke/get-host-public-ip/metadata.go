@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// metadataInterface is a network interface as the metadata server lists it
+type metadataInterface struct {
+	IP            string   `json:"ip"`
+	IPAliases     []string `json:"ipAliases"`
+	IPv6s         []string `json:"ipv6s"`
+	AccessConfigs []struct {
+		ExternalIP   string `json:"externalIp"`
+		ExternalIPv6 string `json:"externalIpv6"`
+		Type         string `json:"type"`
+	} `json:"accessConfigs"`
+}
+
+// getNodeIPFromMetadata returns the external IP of the node from the metadata
+// server. It needs no credentials, but fails off GCE and on any instance other
+// than the node.
+func getNodeIPFromMetadata(endpoint, nodeName string, timeout time.Duration) (externalAddress string, exists bool, err error) {
+	if err := checkMetadataInstance(endpoint, nodeName, timeout); err != nil {
+		return "", false, err
+	}
+
+	var nics []metadataInterface
+	if err := getMetadata(endpoint, "instance/network-interfaces/?recursive=true", timeout, &nics); err != nil {
+		return "", false, err
+	}
+
+	for _, ni := range nics {
+		for _, ac := range ni.AccessConfigs {
+			if ac.ExternalIP != "" {
+				return ac.ExternalIP, true, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+// checkMetadataInstance fails unless the metadata server describes the node:
+// it answers for the instance the tool runs on, which is only the node when
+// the tool runs on it
+func checkMetadataInstance(endpoint, nodeName string, timeout time.Duration) error {
+	var name string
+	if err := getMetadata(endpoint, "instance/name?alt=json", timeout, &name); err != nil {
+		return err
+	}
+
+	if name != strings.SplitN(nodeName, ".", 2)[0] {
+		return fmt.Errorf("the metadata server describes instance %s, not node %s", name, nodeName)
+	}
+	return nil
+}
+
+// metadataLocation returns the project and zone of the instance the tool runs
+// on
+func metadataLocation(endpoint string, timeout time.Duration) (projectID, zone string, err error) {
+	if err := getMetadata(endpoint, "project/project-id?alt=json", timeout, &projectID); err != nil {
+		return "", "", err
+	}
+	// projects/<number>/zones/<zone>
+	if err := getMetadata(endpoint, "instance/zone?alt=json", timeout, &zone); err != nil {
+		return "", "", err
+	}
+	return projectID, zone[strings.LastIndex(zone, "/")+1:], nil
+}
+
+// getMetadata decodes the JSON of a metadata server path
+func getMetadata(endpoint, path string, timeout time.Duration, v interface{}) error {
+	url := strings.TrimSuffix(endpoint, "/") + "/" + path
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	hc := &http.Client{Timeout: timeout}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("metadata server returned %s for %s", resp.Status, url)
+	}
+	// anything else answering on the endpoint isn't the metadata server
+	if resp.Header.Get("Metadata-Flavor") != "Google" {
+		return fmt.Errorf("%s didn't answer as a metadata server", url)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", url, err)
+	}
+	return nil
+}
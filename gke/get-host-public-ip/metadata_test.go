@@ -0,0 +1,176 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// metadataStub answers like the metadata server: paths map to JSON bodies,
+// flavor is the Metadata-Flavor header it sends back
+func metadataStub(t *testing.T, flavor string, status int, paths map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			t.Errorf("request to %s without Metadata-Flavor: Google", r.URL)
+		}
+		if flavor != "" {
+			w.Header().Set("Metadata-Flavor", flavor)
+		}
+
+		body, ok := paths[r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestGetNodeIPFromMetadata(t *testing.T) {
+	const (
+		namePath = "/instance/name?alt=json"
+		nicsPath = "/instance/network-interfaces/?recursive=true"
+	)
+	node := map[string]string{
+		namePath: `"gke-prod-default-pool-1a2b3c4d-x1y2"`,
+		nicsPath: `[{"ip": "10.132.0.2", "accessConfigs": [{"type": "ONE_TO_ONE_NAT", "externalIp": "35.195.1.2"}]}]`,
+	}
+
+	tests := []struct {
+		name     string
+		flavor   string
+		status   int
+		paths    map[string]string
+		nodeName string
+		ip       string
+		exists   bool
+		wantErr  bool
+	}{
+		{
+			name:     "external ip",
+			flavor:   "Google",
+			status:   http.StatusOK,
+			paths:    node,
+			nodeName: "gke-prod-default-pool-1a2b3c4d-x1y2",
+			ip:       "35.195.1.2",
+			exists:   true,
+		},
+		{
+			name:     "node name with a domain",
+			flavor:   "Google",
+			status:   http.StatusOK,
+			paths:    node,
+			nodeName: "gke-prod-default-pool-1a2b3c4d-x1y2.c.project.internal",
+			ip:       "35.195.1.2",
+			exists:   true,
+		},
+		{
+			name:   "no access config",
+			flavor: "Google",
+			status: http.StatusOK,
+			paths: map[string]string{
+				namePath: node[namePath],
+				nicsPath: `[{"ip": "10.132.0.2"}]`,
+			},
+			nodeName: "gke-prod-default-pool-1a2b3c4d-x1y2",
+		},
+		{
+			name:     "another instance",
+			flavor:   "Google",
+			status:   http.StatusOK,
+			paths:    node,
+			nodeName: "gke-prod-default-pool-1a2b3c4d-zzzz",
+			wantErr:  true,
+		},
+		{
+			name:     "wrong flavor",
+			flavor:   "",
+			status:   http.StatusOK,
+			paths:    node,
+			nodeName: "gke-prod-default-pool-1a2b3c4d-x1y2",
+			wantErr:  true,
+		},
+		{
+			name:     "not found",
+			flavor:   "Google",
+			status:   http.StatusOK,
+			paths:    map[string]string{namePath: node[namePath]},
+			nodeName: "gke-prod-default-pool-1a2b3c4d-x1y2",
+			wantErr:  true,
+		},
+		{
+			name:     "server error",
+			flavor:   "Google",
+			status:   http.StatusServiceUnavailable,
+			paths:    node,
+			nodeName: "gke-prod-default-pool-1a2b3c4d-x1y2",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		srv := metadataStub(t, tt.flavor, tt.status, tt.paths)
+		ip, exists, err := getNodeIPFromMetadata(srv.URL, tt.nodeName, time.Second)
+		srv.Close()
+
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: getNodeIPFromMetadata() error = %v, wantErr %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		if ip != tt.ip || exists != tt.exists {
+			t.Errorf("%s: getNodeIPFromMetadata() = %q, %t, want %q, %t", tt.name, ip, exists, tt.ip, tt.exists)
+		}
+	}
+}
+
+func TestAddressesFromMetadata(t *testing.T) {
+	srv := metadataStub(t, "Google", http.StatusOK, map[string]string{
+		"/instance/name?alt=json": `"node-1"`,
+		"/instance/network-interfaces/?recursive=true": `[{
+			"ip": "10.132.0.2",
+			"ipAliases": ["10.4.1.0/24"],
+			"accessConfigs": [{"type": "ONE_TO_ONE_NAT", "externalIp": "35.195.1.2"}]
+		}]`,
+	})
+	defer srv.Close()
+
+	if _, err := addressesFromMetadata(srv.URL, "node-2", time.Second); err == nil {
+		t.Errorf("addressesFromMetadata() of another node: no error")
+	}
+
+	addrs, err := addressesFromMetadata(srv.URL, "node-1", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []nodeAddress{
+		newAddress("10.132.0.2", typeInternal, "metadata", "network-interfaces/0/ip"),
+		newAddress("10.4.1.0/24", typeInternal, "metadata", "network-interfaces/0/ip-aliases/0"),
+		newAddress("35.195.1.2", typeExternal, "metadata", "network-interfaces/0/access-configs/0/external-ip"),
+	}
+	if len(addrs) != len(want) {
+		t.Fatalf("addressesFromMetadata() = %v, want %v", addrs, want)
+	}
+	for i := range want {
+		if addrs[i] != want[i] {
+			t.Errorf("addressesFromMetadata()[%d] = %v, want %v", i, addrs[i], want[i])
+		}
+	}
+}
+
+func TestMetadataLocation(t *testing.T) {
+	srv := metadataStub(t, "Google", http.StatusOK, map[string]string{
+		"/project/project-id?alt=json": `"my-project"`,
+		"/instance/zone?alt=json":      `"projects/123456789/zones/europe-west1-b"`,
+	})
+	defer srv.Close()
+
+	projectID, zone, err := metadataLocation(srv.URL, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if projectID != "my-project" || zone != "europe-west1-b" {
+		t.Errorf("metadataLocation() = %s, %s, want my-project, europe-west1-b", projectID, zone)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pondohva/golang-samples/gke/pricing"
+	"google.golang.org/api/container/v1"
+)
+
+// pricedNode is the node config as the shared pricing package prices it
+func pricedNode(config *container.NodeConfig) pricing.Node {
+	return pricing.Node{
+		MachineType:   config.MachineType,
+		DiskSizeGb:    config.DiskSizeGb,
+		DiskType:      config.DiskType,
+		LocalSsdCount: config.LocalSsdCount,
+		Preemptible:   config.Preemptible,
+	}
+}
+
+// printCostDelta prints what adding nodes built from the node config costs
+func printCostDelta(region string, config *container.NodeConfig, nodes int64) {
+	pricing.PrintCostDelta(*pricingFile, region, pricedNode(config), nodes)
+}
+
+// confirm asks the question on a terminal. Without one, or with --yes, the
+// change goes ahead as it always did.
+func confirm(question string) bool {
+	if *yes {
+		return true
+	}
+
+	fi, err := os.Stdin.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return true
+	}
+
+	fmt.Printf("%s [y/N] ", question)
+	var answer string
+	fmt.Scanln(&answer)
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// printClusterCost prints the current monthly cost of every node pool of the
+// cluster
+func (cl *client) printClusterCost(projectID, zone, clusterID string) error {
+	t, err := pricing.Load(*pricingFile)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := cl.containerClient.Projects.Zones.Clusters.Get(projectID, zone, clusterID).Do()
+	if err != nil {
+		return err
+	}
+
+	region := regionOf(zone)
+	total := 0.0
+
+	fmt.Printf("Cluster %q, pricing %s\n", cluster.Name, t.Version)
+
+	for _, np := range cluster.NodePools {
+		nodes := int64(0)
+		for _, url := range np.InstanceGroupUrls {
+			parts := strings.Split(url, "/")
+			igZone, igName := parts[len(parts)-3], parts[len(parts)-1]
+
+			ig, err := cl.computeClient.InstanceGroupManagers.Get(projectID, igZone, igName).Do()
+			if err != nil {
+				return fmt.Errorf("failed to get instance group manager %s: %v", igName, err)
+			}
+			nodes += ig.TargetSize
+		}
+
+		hourly, err := t.NodeHourly(region, pricedNode(np.Config))
+		if err != nil {
+			fmt.Printf("\tNodePool %q, nodes: %d, machine_type: %s, cost: unknown (%v)\n", np.Name, nodes, np.Config.MachineType, err)
+			continue
+		}
+
+		monthly := hourly * float64(nodes) * t.HoursPerMonth
+		total += monthly
+
+		fmt.Printf("\tNodePool %q, nodes: %d, machine_type: %s, preemptible: %t, cost: %.2f %s/month\n",
+			np.Name, nodes, np.Config.MachineType, np.Config.Preemptible, monthly, t.Currency)
+	}
+
+	fmt.Printf("Total: %.2f %s/month\n", total, t.Currency)
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"0 20 * * 1-5", false},
+		{"*/15 * * * *", false},
+		{"0,30 8-18/2 1 1-12 0", false},
+		{"0 0 * * 7", false},
+		{"* * * *", true},
+		{"* * * * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"*/0 * * * *", true},
+		{"5-1 * * * *", true},
+		{"a * * * *", true},
+		{"1-a * * * *", true},
+	}
+
+	for _, tt := range tests {
+		_, err := parseCron(tt.expr)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCron(%q) error = %v, wantErr %t", tt.expr, err, tt.wantErr)
+		}
+	}
+
+	s, err := parseCron("0 0 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.dow[0] {
+		t.Errorf("parseCron(%q): 7 is not Sunday", "0 0 * * 7")
+	}
+}
+
+func TestCronNextPrev(t *testing.T) {
+	ams, err := time.LoadLocation("Europe/Amsterdam")
+	if err != nil {
+		t.Skipf("no time zone data: %v", err)
+	}
+	at := func(year int, month time.Month, day, hour, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, ams)
+	}
+
+	tests := []struct {
+		name   string
+		expr   string
+		from   time.Time
+		next   time.Time
+		noNext bool
+		prev   time.Time
+	}{
+		{
+			name: "weekdays skip the weekend",
+			expr: "0 20 * * 1-5",
+			from: at(2018, 10, 19, 21, 0),
+			next: at(2018, 10, 22, 20, 0),
+			prev: at(2018, 10, 19, 20, 0),
+		},
+		{
+			name: "next is strictly after, prev at or before",
+			expr: "*/15 * * * *",
+			from: at(2018, 10, 19, 10, 15),
+			next: at(2018, 10, 19, 10, 30),
+			prev: at(2018, 10, 19, 10, 15),
+		},
+		{
+			name: "either restricted day field matches",
+			expr: "0 0 1 * 1",
+			from: at(2018, 10, 2, 12, 0),
+			next: at(2018, 10, 8, 0, 0),
+			prev: at(2018, 10, 1, 0, 0),
+		},
+		{
+			name: "a time skipped by daylight saving moves to the next day",
+			expr: "30 2 * * *",
+			from: at(2018, 3, 24, 12, 0),
+			next: at(2018, 3, 26, 2, 30),
+			prev: at(2018, 3, 24, 2, 30),
+		},
+		{
+			name: "a repeated hour runs once",
+			expr: "30 2 * * *",
+			from: at(2018, 10, 28, 0, 0),
+			next: time.Date(2018, 10, 28, 1, 30, 0, 0, time.UTC).In(ams),
+			prev: at(2018, 10, 27, 2, 30),
+		},
+		{
+			name:   "never",
+			expr:   "0 0 30 2 *",
+			from:   at(2018, 1, 1, 0, 0),
+			noNext: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next, ok := s.next(tt.from)
+			if ok == tt.noNext {
+				t.Fatalf("next(%s) ok = %t", tt.from, ok)
+			}
+			if tt.noNext {
+				return
+			}
+			if !next.Equal(tt.next) {
+				t.Errorf("next(%s) = %s, want %s", tt.from, next, tt.next)
+			}
+			if after, ok := s.next(next); ok && after.YearDay() == next.YearDay() && tt.expr == "30 2 * * *" {
+				t.Errorf("next(%s) = %s, ran twice on one day", next, after)
+			}
+
+			prev, ok := s.prev(tt.from)
+			if !ok || !prev.Equal(tt.prev) {
+				t.Errorf("prev(%s) = %s, %t, want %s", tt.from, prev, ok, tt.prev)
+			}
+		})
+	}
+}
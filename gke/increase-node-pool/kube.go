@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/api/container/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeContext is the kubeconfig context gcloud container clusters
+// get-credentials creates for a cluster
+func kubeContext(projectID, zone, clusterID string) string {
+	return fmt.Sprintf("gke_%s_%s_%s", projectID, zone, clusterID)
+}
+
+// kubeClientForCluster returns a client for the cluster's context of the
+// kubeconfig, or for the cluster of the pod the tool runs in when the
+// kubeconfig doesn't have it. Check it with checkPoolNodes before changing
+// nodes, the pod may run in another cluster.
+func kubeClientForCluster(projectID, zone, clusterID string) (*kubernetes.Clientset, error) {
+	context := kubeContext(projectID, zone, clusterID)
+
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: *kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
+	if err != nil {
+		var inClusterErr error
+		if config, inClusterErr = GetConfigInCluster(); inClusterErr != nil {
+			return nil, fmt.Errorf("no kubeconfig context %s (%v), run gcloud container clusters get-credentials %s", context, err, clusterID)
+		}
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// checkPoolNodes fails unless the nodes the API server has for the pool are
+// instances of the GKE node pool, so a client for another cluster with a pool
+// of the same name is caught before it touches any node
+func (cl *client) checkPoolNodes(kc *kubernetes.Clientset, projectID, clusterID string, np *container.NodePool) error {
+	instances := make(map[string]bool)
+	for _, url := range np.InstanceGroupUrls {
+		parts := strings.Split(url, "/")
+		if len(parts) < 4 || parts[len(parts)-4] != "zones" {
+			return fmt.Errorf("unexpected instance group url %s", url)
+		}
+		zone, name := parts[len(parts)-3], parts[len(parts)-1]
+
+		mis, err := cl.computeClient.InstanceGroupManagers.ListManagedInstances(projectID, zone, name).Do()
+		if err != nil {
+			return fmt.Errorf("failed to list instances of %s: %v", name, err)
+		}
+		for _, mi := range mis.ManagedInstances {
+			instances[mi.Instance[strings.LastIndex(mi.Instance, "/")+1:]] = true
+		}
+	}
+
+	nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{nodePoolLabel: np.Name}).String(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes of %s: %v", np.Name, err)
+	}
+
+	if len(nodes.Items) == 0 && len(instances) > 0 {
+		return fmt.Errorf("the Kubernetes API has no nodes of node pool %s, it isn't cluster %s", np.Name, clusterID)
+	}
+	for _, n := range nodes.Items {
+		if !instances[n.Name] {
+			return fmt.Errorf("node %s isn't an instance of node pool %s of cluster %s, the Kubernetes API is another cluster's", n.Name, np.Name, clusterID)
+		}
+	}
+
+	return nil
+}
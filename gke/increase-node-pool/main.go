@@ -1,30 +1,45 @@
 package main
 
 import (
-	"log"
 	"context"
-	"golang.org/x/oauth2/google"
-	"google.golang.org/api/container/v1"
-	"google.golang.org/api/compute/v1"
-	"os"
-
 	"flag"
+	"fmt"
+	"log"
+	"os"
 	"path/filepath"
-	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
 	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
-	"strings"
-	"fmt"
+)
+
+var (
+	kubeconfig  = flag.String("kubeconfig", defaultKubeconfig(), "(optional) absolute path to the kubeconfig file")
+	wait        = flag.Bool("wait", false, "wait until the new nodes are Ready and schedulable in Kubernetes")
+	waitTimeout = flag.Duration("wait-timeout", 15*time.Minute, "how long to wait for the new nodes with --wait")
+	apply       = flag.Bool("apply", false, "plan: resize the node pool by the computed delta")
+
+	drainTimeout = flag.Duration("drain-timeout", 10*time.Minute, "how long to wait for the nodes removed by a scale-down to drain")
+
+	scheduleFile = flag.String("schedule", "schedule.yaml", "scheduler: YAML file with the scaling schedule")
+	statusAddr   = flag.String("status-addr", ":8080", "scheduler: address of the status endpoint")
+
+	pricingFile = flag.String("pricing", "", "pricing table used for cost estimates, by default pricing.json next to the binary or in its parent directory")
+	yes         = flag.Bool("yes", false, "don't ask for confirmation")
 )
 
 type client struct {
 	containerClient *container.Service
-	computeClient *compute.Service
-	kubeClient *kubernetes.Clientset
+	computeClient   *compute.Service
+	kubeClient      *kubernetes.Clientset
 }
 
-
 func GetConfigInCluster() (*restclient.Config, error) {
 	config, err := restclient.InClusterConfig()
 	if err != nil {
@@ -35,14 +50,6 @@ func GetConfigInCluster() (*restclient.Config, error) {
 }
 
 func GetConfigOutOfCluster() (*restclient.Config, error) {
-	var kubeconfig *string
-	if home := homeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-	} else {
-		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
-	}
-	flag.Parse()
-
 	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
 	if err != nil {
 		return nil, err
@@ -51,6 +58,13 @@ func GetConfigOutOfCluster() (*restclient.Config, error) {
 	return config, nil
 }
 
+func defaultKubeconfig() string {
+	if home := homeDir(); home != "" {
+		return filepath.Join(home, ".kube", "config")
+	}
+	return ""
+}
+
 func homeDir() string {
 	if h := os.Getenv("HOME"); h != "" {
 		return h
@@ -58,7 +72,6 @@ func homeDir() string {
 	return os.Getenv("USERPROFILE") // windows
 }
 
-
 func NewClient(ctx context.Context) *client {
 
 	hc, err := google.DefaultClient(ctx, container.CloudPlatformScope)
@@ -72,7 +85,6 @@ func NewClient(ctx context.Context) *client {
 		log.Panic(err)
 	}
 
-
 	config, err := GetConfigInCluster()
 
 	if err != nil {
@@ -90,12 +102,13 @@ func NewClient(ctx context.Context) *client {
 
 	return &client{
 		containerClient: containerSvc,
-		computeClient: computeSvc,
-		kubeClient: k8sClient,
+		computeClient:   computeSvc,
+		kubeClient:      k8sClient,
 	}
 }
 
 func main() {
+	flag.Parse()
 	ctx := context.Background()
 
 	projectID, ok := os.LookupEnv("GKE_PROJECT_ID")
@@ -106,36 +119,117 @@ func main() {
 	if !ok {
 		log.Fatal("set GKE_ZONE")
 	}
+
+	cl := NewClient(ctx)
+
+	if flag.Arg(0) == "scheduler" {
+		if err := cl.runScheduler(projectID, zone, *scheduleFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	clusterID, ok := os.LookupEnv("GKE_CLUSTER_ID")
 	if !ok {
 		log.Fatal("set GKE_CLUSTER_ID")
 	}
-	nodePoolID, ok := os.LookupEnv("GKE_NODE_POOL_ID")
 
-	cl := NewClient(ctx)
+	if flag.Arg(0) == "cost" {
+		if err := cl.printClusterCost(projectID, zone, clusterID); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
+	nodePoolID, ok := os.LookupEnv("GKE_NODE_POOL_ID")
 
 	np, err := cl.containerClient.Projects.Zones.Clusters.NodePools.Get(projectID, zone, clusterID, nodePoolID).Do()
 	if err != nil {
 		log.Fatal("failed to get nodepools")
 	}
 
+	igUrl := instanceGroupName(np)
+
+	switch flag.Arg(0) {
+	case "plan":
+		delta, err := cl.plan(projectID, zone, clusterID, np)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *apply && delta > 0 {
+			cl.resize(projectID, zone, clusterID, igUrl, np, delta)
+		}
+	case "":
+		cl.resize(projectID, zone, clusterID, igUrl, np, 1)
+	default:
+		log.Fatalf("unknown command %q", flag.Arg(0))
+	}
+}
+
+// instanceGroupName returns the name of the node pool's instance group manager
+func instanceGroupName(np *container.NodePool) string {
 	parts := strings.Split(np.InstanceGroupUrls[0], "/")
-	igUrl := parts[len(parts)-1]
+	return parts[len(parts)-1]
+}
 
+// resize grows the instance group of the node pool by delta nodes
+func (cl *client) resize(projectID, zone, clusterID, igUrl string, np *container.NodePool, delta int64) {
+	ig, err := cl.computeClient.InstanceGroupManagers.Get(projectID, zone, igUrl).Do()
 	if err != nil {
 		log.Fatal("failed to get instance group managers")
 	}
 
+	printCostDelta(regionOf(zone), np.Config, delta)
+	if !confirm(fmt.Sprintf("Resize %s from %d to %d nodes?", ig.Name, ig.TargetSize, ig.TargetSize+delta)) {
+		fmt.Println("Skipping resize")
+		return
+	}
 
-	ig, err := cl.computeClient.InstanceGroupManagers.Get(projectID, zone, igUrl).Do()
+	if err := cl.resizeGroup(projectID, zone, clusterID, np, ig, ig.TargetSize+delta); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// resizeGroup sets the target size of the node pool's instance group,
+// checking the quota first when it grows and draining the removed nodes when
+// it shrinks
+func (cl *client) resizeGroup(projectID, zone, clusterID string, np *container.NodePool, ig *compute.InstanceGroupManager, size int64) error {
+	if size < ig.TargetSize {
+		return cl.shrinkGroup(projectID, zone, clusterID, np, ig, size)
+	}
+
+	if size > ig.TargetSize {
+		needs, err := cl.quotaNeeds(projectID, zone, np.Config, size-ig.TargetSize)
+		if err != nil {
+			return err
+		}
+		if err := cl.checkQuota(projectID, zone, needs); err != nil {
+			return err
+		}
+	}
 
 	fmt.Printf("ig %s, size %d\n", ig.Name, ig.TargetSize)
-	_, err = cl.computeClient.InstanceGroupManagers.Resize(projectID, zone, igUrl, ig.TargetSize + 1).Do()
+	op, err := cl.computeClient.InstanceGroupManagers.Resize(projectID, zone, ig.Name, size).Do()
 
 	if err != nil {
-		log.Fatal("failed to resize nodepool")
+		return fmt.Errorf("failed to resize nodepool: %v", err)
 	}
 
+	if *wait {
+		deadline := time.Now().Add(*waitTimeout)
+
+		if err := cl.waitForZoneOperation(projectID, zone, op.Name, deadline); err != nil {
+			return err
+		}
 
-}
\ No newline at end of file
+		kc, err := kubeClientForCluster(projectID, zone, clusterID)
+		if err != nil {
+			return err
+		}
+		if err := cl.waitForNodesReady(kc, projectID, zone, ig.Name, np.Name, size, deadline); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/api/container/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// resources is the part of a node or a pod the planner packs by
+type resources struct {
+	milliCPU int64
+	memory   int64
+	pods     int64
+}
+
+func (r resources) fits(capacity resources) bool {
+	return r.milliCPU <= capacity.milliCPU && r.memory <= capacity.memory && r.pods <= capacity.pods
+}
+
+func (r resources) sub(o resources) resources {
+	return resources{r.milliCPU - o.milliCPU, r.memory - o.memory, r.pods - o.pods}
+}
+
+func (r resources) String() string {
+	return fmt.Sprintf("cpu: %dm, memory: %dMi, pods: %d", r.milliCPU, r.memory/(1024*1024), r.pods)
+}
+
+// plan prints how many nodes the node pool needs to run every unschedulable
+// pending pod that is allowed on it and returns that delta. Nodes and pods are
+// read from the cluster's context, checked to be the pool's.
+func (cl *client) plan(projectID, zone, clusterID string, np *container.NodePool) (int64, error) {
+	kc, err := kubeClientForCluster(projectID, zone, clusterID)
+	if err != nil {
+		return 0, err
+	}
+	if err := cl.checkPoolNodes(kc, projectID, clusterID, np); err != nil {
+		return 0, fmt.Errorf("not planning %s: %v", np.Name, err)
+	}
+
+	mt, err := cl.computeClient.MachineTypes.Get(projectID, zone, np.Config.MachineType).Do()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get machine type %s: %v", np.Config.MachineType, err)
+	}
+	fmt.Printf("machine type %s: %d vCPU, %d MB memory\n", mt.Name, mt.GuestCpus, mt.MemoryMb)
+
+	nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{nodePoolLabel: np.Name}).String(),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	// Without a node to learn from the whole machine is the best guess,
+	// with the pool's labels and the default pod limit.
+	allocatable := resources{mt.GuestCpus * 1000, mt.MemoryMb * 1024 * 1024, 110}
+	nodeLabels := map[string]string{nodePoolLabel: np.Name}
+	for k, v := range np.Config.Labels {
+		nodeLabels[k] = v
+	}
+	var taints []v1.Taint
+
+	if len(nodes.Items) > 0 {
+		n := nodes.Items[0]
+		allocatable = resources{
+			milliCPU: n.Status.Allocatable.Cpu().MilliValue(),
+			memory:   n.Status.Allocatable.Memory().Value(),
+			pods:     n.Status.Allocatable.Pods().Value(),
+		}
+		nodeLabels = n.Labels
+		taints = n.Spec.Taints
+	} else {
+		fmt.Println("no nodes in the node pool, using machine type capacity")
+	}
+	fmt.Printf("node allocatable: %s\n", allocatable)
+
+	pending, err := kc.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: "status.phase=Pending",
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pods: %v", err)
+	}
+
+	var requests []resources
+	for _, pod := range pending.Items {
+		if !isUnschedulable(&pod) {
+			continue
+		}
+		if !matchesNodeSelector(&pod, nodeLabels) || !toleratesTaints(&pod, taints) {
+			fmt.Printf("skip %s/%s: not allowed on node pool %s\n", pod.Namespace, pod.Name, np.Name)
+			continue
+		}
+
+		r := podRequests(&pod)
+		if !r.fits(allocatable) {
+			fmt.Printf("skip %s/%s: requests (%s) don't fit a single node\n", pod.Namespace, pod.Name, r)
+			continue
+		}
+
+		fmt.Printf("pending %s/%s: %s\n", pod.Namespace, pod.Name, r)
+		requests = append(requests, r)
+	}
+
+	delta := binPack(requests, allocatable)
+
+	fmt.Printf("unschedulable pods: %d, nodes to add: %d\n", len(requests), delta)
+
+	return delta, nil
+}
+
+func isUnschedulable(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodScheduled && c.Status == v1.ConditionFalse && c.Reason == v1.PodReasonUnschedulable {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesNodeSelector(pod *v1.Pod, nodeLabels map[string]string) bool {
+	return labels.SelectorFromSet(pod.Spec.NodeSelector).Matches(labels.Set(nodeLabels))
+}
+
+func toleratesTaints(pod *v1.Pod, taints []v1.Taint) bool {
+	for i := range taints {
+		if taints[i].Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := false
+		for j := range pod.Spec.Tolerations {
+			if pod.Spec.Tolerations[j].ToleratesTaint(&taints[i]) {
+				tolerated = true
+				break
+			}
+		}
+		if !tolerated {
+			return false
+		}
+	}
+	return true
+}
+
+// podRequests sums the requests of the containers the way the scheduler does:
+// init containers run one by one, so only the biggest of them counts
+func podRequests(pod *v1.Pod) resources {
+	r := resources{pods: 1}
+	for _, c := range pod.Spec.Containers {
+		r.milliCPU += c.Resources.Requests.Cpu().MilliValue()
+		r.memory += c.Resources.Requests.Memory().Value()
+	}
+	for _, c := range pod.Spec.InitContainers {
+		if cpu := c.Resources.Requests.Cpu().MilliValue(); cpu > r.milliCPU {
+			r.milliCPU = cpu
+		}
+		if mem := c.Resources.Requests.Memory().Value(); mem > r.memory {
+			r.memory = mem
+		}
+	}
+	return r
+}
+
+// binPack places the requests on empty nodes first-fit decreasing and returns
+// the number of nodes used
+func binPack(requests []resources, allocatable resources) int64 {
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].milliCPU != requests[j].milliCPU {
+			return requests[i].milliCPU > requests[j].milliCPU
+		}
+		return requests[i].memory > requests[j].memory
+	})
+
+	var free []resources
+	for _, r := range requests {
+		placed := false
+		for i := range free {
+			if r.fits(free[i]) {
+				free[i] = free[i].sub(r)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			free = append(free, allocatable.sub(r))
+		}
+	}
+
+	return int64(len(free))
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/api/container/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// scheduleConfig is the scheduler's YAML file:
+//
+//	timezone: Europe/Amsterdam
+//	jitter: 2m
+//	actions:
+//	- cluster: batch
+//	  nodePool: workers
+//	  schedule: "0 20 * * 1-5"
+//	  size: 10
+//	- cluster: batch
+//	  nodePool: workers
+//	  schedule: "0 7 * * 1-5"
+//	  autoscaling: {min: 0, max: 3}
+//
+// size is the number of nodes in GKE_ZONE: only the pool's instance group in
+// that zone is resized, so in multi-zone pools it is per zone and the other
+// zones keep their size. Going down, the removed nodes are cordoned and
+// drained first.
+type scheduleConfig struct {
+	TimeZone string            `yaml:"timezone"`
+	Jitter   time.Duration     `yaml:"jitter"`
+	Actions  []*scheduleAction `yaml:"actions"`
+}
+
+type scheduleAction struct {
+	Cluster     string             `yaml:"cluster"`
+	NodePool    string             `yaml:"nodePool"`
+	Schedule    string             `yaml:"schedule"`
+	TimeZone    string             `yaml:"timezone"`
+	Size        *int64             `yaml:"size"`
+	Autoscaling *autoscalingBounds `yaml:"autoscaling"`
+
+	cron     *cronSchedule
+	location *time.Location
+}
+
+type autoscalingBounds struct {
+	Min int64 `yaml:"min"`
+	Max int64 `yaml:"max"`
+}
+
+func (a *scheduleAction) String() string {
+	if a.Size != nil {
+		return fmt.Sprintf("%s/%s: size %d", a.Cluster, a.NodePool, *a.Size)
+	}
+	return fmt.Sprintf("%s/%s: autoscaling %d-%d", a.Cluster, a.NodePool, a.Autoscaling.Min, a.Autoscaling.Max)
+}
+
+// actionStatus is what the status endpoint reports for every action
+type actionStatus struct {
+	Cluster   string    `json:"cluster"`
+	NodePool  string    `json:"nodePool"`
+	Schedule  string    `json:"schedule"`
+	Action    string    `json:"action"`
+	Next      time.Time `json:"next"`
+	LastRun   time.Time `json:"lastRun"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+type scheduler struct {
+	cl        *client
+	projectID string
+	zone      string
+	jitter    time.Duration
+
+	// running serializes the changes, mu only guards status so the status
+	// endpoint answers while a change runs
+	running sync.Mutex
+	mu      sync.Mutex
+	status  map[*scheduleAction]*actionStatus
+}
+
+func loadSchedule(path string) (*scheduleConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg scheduleConfig
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	defaultLocation, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("%s: timezone: %v", path, err)
+	}
+
+	for i, a := range cfg.Actions {
+		if a.Cluster == "" || a.NodePool == "" {
+			return nil, fmt.Errorf("%s: action %d: cluster and nodePool are required", path, i)
+		}
+		if (a.Size == nil) == (a.Autoscaling == nil) {
+			return nil, fmt.Errorf("%s: action %d: set either size or autoscaling", path, i)
+		}
+		if a.Autoscaling != nil && a.Autoscaling.Min > a.Autoscaling.Max {
+			return nil, fmt.Errorf("%s: action %d: autoscaling min is greater than max", path, i)
+		}
+
+		if a.cron, err = parseCron(a.Schedule); err != nil {
+			return nil, fmt.Errorf("%s: action %d: %v", path, i, err)
+		}
+
+		a.location = defaultLocation
+		if a.TimeZone != "" {
+			if a.location, err = time.LoadLocation(a.TimeZone); err != nil {
+				return nil, fmt.Errorf("%s: action %d: timezone: %v", path, i, err)
+			}
+		}
+	}
+
+	return &cfg, nil
+}
+
+// runScheduler applies the actions of the schedule file as they come due and
+// serves their status until the process is stopped
+func (cl *client) runScheduler(projectID, zone, path string) error {
+	cfg, err := loadSchedule(path)
+	if err != nil {
+		return err
+	}
+
+	s := &scheduler{
+		cl:        cl,
+		projectID: projectID,
+		zone:      zone,
+		jitter:    cfg.Jitter,
+		status:    make(map[*scheduleAction]*actionStatus),
+	}
+
+	for _, a := range cfg.Actions {
+		s.status[a] = &actionStatus{
+			Cluster:  a.Cluster,
+			NodePool: a.NodePool,
+			Schedule: a.Schedule,
+			Action:   a.String(),
+		}
+	}
+
+	s.catchUp(cfg.Actions)
+
+	for _, a := range cfg.Actions {
+		go s.loop(a)
+	}
+
+	http.HandleFunc("/status", s.serveStatus)
+	log.Printf("scheduler: %d actions, status on %s/status", len(cfg.Actions), *statusAddr)
+
+	return http.ListenAndServe(*statusAddr, nil)
+}
+
+// catchUp re-applies the most recent past action of every node pool, so a
+// restart leaves the pools as the schedule says they should be by now
+func (s *scheduler) catchUp(actions []*scheduleAction) {
+	now := time.Now()
+	latest := make(map[string]*scheduleAction)
+	latestAt := make(map[string]time.Time)
+
+	for _, a := range actions {
+		at, ok := a.cron.prev(now.In(a.location))
+		if !ok {
+			continue
+		}
+
+		key := a.Cluster + "/" + a.NodePool
+		if at.After(latestAt[key]) {
+			latest[key] = a
+			latestAt[key] = at
+		}
+	}
+
+	keys := make([]string, 0, len(latest))
+	for k := range latest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		log.Printf("scheduler: catching up on %s due at %s", latest[k], latestAt[k])
+		s.run(latest[k])
+	}
+}
+
+func (s *scheduler) loop(a *scheduleAction) {
+	for {
+		next, ok := a.cron.next(time.Now().In(a.location))
+		if !ok {
+			log.Printf("scheduler: %q never runs again", a.Schedule)
+			return
+		}
+
+		if s.jitter > 0 {
+			next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+		}
+
+		s.mu.Lock()
+		s.status[a].Next = next
+		s.mu.Unlock()
+
+		time.Sleep(time.Until(next))
+		s.run(a)
+	}
+}
+
+func (s *scheduler) run(a *scheduleAction) {
+	s.running.Lock()
+	err := s.apply(a)
+	s.running.Unlock()
+
+	if err != nil {
+		log.Printf("scheduler: %s failed: %v", a, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := s.status[a]
+	st.LastRun = time.Now()
+	st.LastError = ""
+	if err != nil {
+		st.LastError = err.Error()
+	}
+}
+
+// apply brings the node pool to the state of the action, doing nothing when
+// it is already there
+func (s *scheduler) apply(a *scheduleAction) error {
+	cl := s.cl
+
+	np, err := cl.containerClient.Projects.Zones.Clusters.NodePools.Get(s.projectID, s.zone, a.Cluster, a.NodePool).Do()
+	if err != nil {
+		return fmt.Errorf("failed to get nodepool: %v", err)
+	}
+
+	if a.Size != nil {
+		ig, err := cl.computeClient.InstanceGroupManagers.Get(s.projectID, s.zone, instanceGroupName(np)).Do()
+		if err != nil {
+			return fmt.Errorf("failed to get instance group manager: %v", err)
+		}
+
+		if ig.TargetSize == *a.Size {
+			log.Printf("scheduler: %s already applied", a)
+			return nil
+		}
+
+		log.Printf("scheduler: %s, current size %d", a, ig.TargetSize)
+		return cl.resizeGroup(s.projectID, s.zone, a.Cluster, np, ig, *a.Size)
+	}
+
+	if np.Autoscaling != nil && np.Autoscaling.Enabled &&
+		np.Autoscaling.MinNodeCount == a.Autoscaling.Min && np.Autoscaling.MaxNodeCount == a.Autoscaling.Max {
+		log.Printf("scheduler: %s already applied", a)
+		return nil
+	}
+
+	req := &container.SetNodePoolAutoscalingRequest{
+		Autoscaling: &container.NodePoolAutoscaling{
+			Enabled:         true,
+			MinNodeCount:    a.Autoscaling.Min,
+			MaxNodeCount:    a.Autoscaling.Max,
+			ForceSendFields: []string{"MinNodeCount"},
+		},
+	}
+
+	op, err := cl.containerClient.Projects.Zones.Clusters.NodePools.Autoscaling(s.projectID, s.zone, a.Cluster, a.NodePool, req).Do()
+	if err != nil {
+		return fmt.Errorf("failed to set autoscaling: %v", err)
+	}
+
+	log.Printf("scheduler: %s, status %s, id: %s", a, op.Status, op.Name)
+	return nil
+}
+
+func (s *scheduler) serveStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	status := make([]actionStatus, 0, len(s.status))
+	for _, st := range s.status {
+		status = append(status, *st)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Next.Before(status[j].Next)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Printf("scheduler: failed to write status: %v", err)
+	}
+}
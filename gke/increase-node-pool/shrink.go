@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/container/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// shrinkGroup takes the instance group of the node pool down to size like
+// dicrease-node-pool does: it picks nodes, cordons and drains them and deletes
+// exactly those instances. Resizing the group would delete arbitrary nodes
+// with their pods still on them.
+func (cl *client) shrinkGroup(projectID, zone, clusterID string, np *container.NodePool, ig *compute.InstanceGroupManager, size int64) error {
+	kc, err := kubeClientForCluster(projectID, zone, clusterID)
+	if err != nil {
+		return err
+	}
+	if err := cl.checkPoolNodes(kc, projectID, clusterID, np); err != nil {
+		return fmt.Errorf("not shrinking %s: %v", np.Name, err)
+	}
+
+	victims, err := pickVictims(kc, zone, np.Name, ig.TargetSize-size)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("ig %s, size %d, removing %v\n", ig.Name, ig.TargetSize, victims)
+
+	if err := cordonNodes(kc, victims); err != nil {
+		return err
+	}
+	if err := drainNodes(kc, victims, *drainTimeout); err != nil {
+		return fmt.Errorf("failed to drain %v, nothing deleted: %v", victims, err)
+	}
+
+	req := &compute.InstanceGroupManagersDeleteInstancesRequest{}
+	for _, name := range victims {
+		req.Instances = append(req.Instances, fmt.Sprintf("zones/%s/instances/%s", zone, name))
+	}
+
+	op, err := cl.computeClient.InstanceGroupManagers.DeleteInstances(projectID, zone, ig.Name, req).Do()
+	if err != nil {
+		return fmt.Errorf("failed to delete nodes %v: %v", victims, err)
+	}
+
+	if *wait {
+		return cl.waitForZoneOperation(projectID, zone, op.Name, time.Now().Add(*waitTimeout))
+	}
+	return nil
+}
+
+// pickVictims returns count nodes of the pool in the zone to remove: cordoned
+// ones first, then those with the fewest pods to move
+func pickVictims(kc *kubernetes.Clientset, zone, nodePoolID string, count int64) ([]string, error) {
+	list, err := kc.CoreV1().Nodes().List(metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{nodePoolLabel: nodePoolID, zoneLabel: zone}).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes of %s: %v", nodePoolID, err)
+	}
+	if int64(len(list.Items)) < count {
+		return nil, fmt.Errorf("node pool %s has %d nodes in %s, can't remove %d", nodePoolID, len(list.Items), zone, count)
+	}
+
+	nodes := list.Items
+	pods := make(map[string]int)
+	for _, n := range nodes {
+		p, err := evictablePods(kc, n.Name)
+		if err != nil {
+			return nil, err
+		}
+		pods[n.Name] = len(p)
+	}
+
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Spec.Unschedulable != b.Spec.Unschedulable {
+			return a.Spec.Unschedulable
+		}
+		if pods[a.Name] != pods[b.Name] {
+			return pods[a.Name] < pods[b.Name]
+		}
+		return a.Name < b.Name
+	})
+
+	victims := make([]string, 0, count)
+	for _, n := range nodes[:count] {
+		victims = append(victims, n.Name)
+	}
+	return victims, nil
+}
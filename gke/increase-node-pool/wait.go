@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	nodePoolLabel = "cloud.google.com/gke-nodepool"
+	zoneLabel     = "failure-domain.beta.kubernetes.io/zone"
+)
+
+// waitForZoneOperation polls a compute zone operation until it is DONE
+func (cl *client) waitForZoneOperation(projectID, zone, name string, deadline time.Time) error {
+	for {
+		op, err := cl.computeClient.ZoneOperations.Get(projectID, zone, name).Do()
+		if err != nil {
+			return fmt.Errorf("failed to get operation %s: %v", name, err)
+		}
+
+		if op.Status == "DONE" {
+			if op.Error != nil && len(op.Error.Errors) > 0 {
+				msgs := make([]string, 0, len(op.Error.Errors))
+				for _, e := range op.Error.Errors {
+					msgs = append(msgs, fmt.Sprintf("%s: %s", e.Code, e.Message))
+				}
+				return fmt.Errorf("operation %s failed: %s", name, strings.Join(msgs, "; "))
+			}
+			fmt.Printf("operation %s done\n", name)
+			return nil
+		}
+
+		fmt.Printf("operation %s: %s, progress %d%%\n", name, op.Status, op.Progress)
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for operation %s (status %s)", name, op.Status)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// waitForNodesReady watches the nodes of the node pool in the zone of the
+// instance group until expected of them are Ready and schedulable. On timeout
+// it reports the instances of the group that never registered or never became
+// Ready.
+func (cl *client) waitForNodesReady(kc *kubernetes.Clientset, projectID, zone, igUrl, nodePoolID string, expected int64, deadline time.Time) error {
+	opts := metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{nodePoolLabel: nodePoolID, zoneLabel: zone}).String(),
+	}
+
+	var nodes map[string]*v1.Node
+
+	for {
+		list, err := kc.CoreV1().Nodes().List(opts)
+		if err != nil {
+			return fmt.Errorf("failed to list nodes: %v", err)
+		}
+
+		nodes = make(map[string]*v1.Node)
+		for i := range list.Items {
+			nodes[list.Items[i].Name] = &list.Items[i]
+		}
+
+		if reportNodes(nodes, expected) {
+			return nil
+		}
+
+		watchOpts := opts
+		watchOpts.ResourceVersion = list.ResourceVersion
+		w, err := kc.CoreV1().Nodes().Watch(watchOpts)
+		if err != nil {
+			return fmt.Errorf("failed to watch nodes: %v", err)
+		}
+
+		done := watchNodes(w, nodes, expected, deadline)
+		w.Stop()
+		if done {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			break
+		}
+	}
+
+	return cl.notReadyReport(projectID, zone, igUrl, nodes, expected)
+}
+
+// watchNodes applies watch events to nodes until expected nodes are ready,
+// the deadline passes or the watch is closed or fails, e.g. 410 Gone once it
+// expires; the caller lists the nodes again then.
+func watchNodes(w watch.Interface, nodes map[string]*v1.Node, expected int64, deadline time.Time) bool {
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-timeout.C:
+			return false
+		case ev, ok := <-w.ResultChan():
+			if !ok {
+				return false
+			}
+
+			switch ev.Type {
+			case watch.Added, watch.Modified:
+				if n, ok := ev.Object.(*v1.Node); ok {
+					nodes[n.Name] = n
+				}
+			case watch.Deleted:
+				if n, ok := ev.Object.(*v1.Node); ok {
+					delete(nodes, n.Name)
+				}
+			case watch.Error:
+				fmt.Printf("node watch failed, listing again: %v\n", ev.Object)
+				return false
+			}
+
+			if reportNodes(nodes, expected) {
+				return true
+			}
+		}
+	}
+}
+
+// reportNodes prints the progress and returns true once enough nodes are ready
+func reportNodes(nodes map[string]*v1.Node, expected int64) bool {
+	ready := int64(0)
+	for _, n := range nodes {
+		if isNodeReady(n) {
+			ready++
+		}
+	}
+
+	fmt.Printf("nodes registered: %d, ready: %d, expected: %d\n", len(nodes), ready, expected)
+
+	return ready >= expected
+}
+
+func isNodeReady(n *v1.Node) bool {
+	if n.Spec.Unschedulable {
+		return false
+	}
+	for _, c := range n.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func (cl *client) notReadyReport(projectID, zone, igUrl string, nodes map[string]*v1.Node, expected int64) error {
+	var report []string
+
+	instances, err := cl.computeClient.InstanceGroupManagers.ListManagedInstances(projectID, zone, igUrl).Do()
+	if err != nil {
+		report = append(report, fmt.Sprintf("failed to list instances of %s: %v", igUrl, err))
+	} else {
+		for _, mi := range instances.ManagedInstances {
+			parts := strings.Split(mi.Instance, "/")
+			name := parts[len(parts)-1]
+
+			n, ok := nodes[name]
+			switch {
+			case !ok:
+				report = append(report, fmt.Sprintf("%s never registered (instance status %s, action %s)", name, mi.InstanceStatus, mi.CurrentAction))
+			case !isNodeReady(n):
+				report = append(report, fmt.Sprintf("%s registered but not ready or unschedulable", name))
+			}
+		}
+	}
+
+	sort.Strings(report)
+
+	return fmt.Errorf("timed out waiting for %d ready nodes in %s:\n\t%s", expected, igUrl, strings.Join(report, "\n\t"))
+}
@@ -0,0 +1,220 @@
+// Package maintenance decides when a cluster may be changed: inside its daily
+// maintenance window and outside the freezes of a local calendar. It is shared
+// by the tools, so it takes the window as the strings of the cluster's
+// maintenance policy, not the API types each tool vendors.
+package maintenance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Calendar is the local file of periods without upgrades:
+//
+//	{"freezes": [
+//		{"start": "2018-12-20", "end": "2019-01-06", "reason": "holidays"},
+//		{"start": "2018-11-23T00:00:00Z", "end": "2018-11-27T00:00:00Z", "clusters": ["prod"], "reason": "sales"}
+//	]}
+//
+// A freeze without clusters applies to every cluster. Dates without a time are
+// whole days in UTC, the end day included.
+type Calendar struct {
+	Freezes []Freeze `json:"freezes"`
+}
+
+// Freeze is a period of the calendar
+type Freeze struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Clusters []string `json:"clusters"`
+	Reason   string   `json:"reason"`
+
+	start, end time.Time
+}
+
+// AppliesTo reports whether the freeze holds for the cluster
+func (f *Freeze) AppliesTo(clusterID string) bool {
+	if len(f.Clusters) == 0 {
+		return true
+	}
+	for _, c := range f.Clusters {
+		if c == clusterID {
+			return true
+		}
+	}
+	return false
+}
+
+func parseFreezeTime(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// LoadCalendar reads the calendar at path, an empty one when path is ""
+func LoadCalendar(path string) (*Calendar, error) {
+	var cal Calendar
+	if path == "" {
+		return &cal, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cal); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if err := cal.parse(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return &cal, nil
+}
+
+func (cal *Calendar) parse() error {
+	var err error
+	for i := range cal.Freezes {
+		f := &cal.Freezes[i]
+		if f.start, err = parseFreezeTime(f.Start, false); err != nil {
+			return fmt.Errorf("freeze %d: start: %v", i, err)
+		}
+		if f.end, err = parseFreezeTime(f.End, true); err != nil {
+			return fmt.Errorf("freeze %d: end: %v", i, err)
+		}
+		if !f.start.Before(f.end) {
+			return fmt.Errorf("freeze %d: start is not before end", i)
+		}
+	}
+	return nil
+}
+
+var isoDuration = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// ParseISODuration parses the PT4H0M0S durations of maintenance windows
+func ParseISODuration(s string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("unsupported duration %q", s)
+	}
+
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// Window combines the cluster's daily maintenance window with the freezes of
+// the calendar that apply to it
+type Window struct {
+	daily    bool
+	start    time.Duration // since midnight UTC
+	duration time.Duration
+	freezes  []Freeze
+}
+
+// NewWindow returns the window of the cluster whose daily maintenance window
+// starts at startTime, e.g. 03:00, and lasts duration, e.g. PT4H0M0S. A
+// cluster without a daily window has startTime "".
+func NewWindow(clusterID, startTime, duration string, cal *Calendar) (*Window, error) {
+	w := &Window{}
+
+	if startTime != "" {
+		start, err := time.Parse("15:04", startTime)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse maintenance window start %q: %v", startTime, err)
+		}
+		d, err := ParseISODuration(duration)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse maintenance window duration: %v", err)
+		}
+
+		w.daily = true
+		w.start = time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+		w.duration = d
+	}
+
+	for _, f := range cal.Freezes {
+		if f.AppliesTo(clusterID) {
+			w.freezes = append(w.freezes, f)
+		}
+	}
+
+	return w, nil
+}
+
+// Blocked returns why the cluster must not be changed at t, or "" when it may
+func (w *Window) Blocked(t time.Time) string {
+	t = t.UTC()
+
+	for _, f := range w.freezes {
+		if !t.Before(f.start) && t.Before(f.end) {
+			return fmt.Sprintf("freeze %q from %s to %s", f.Reason, f.Start, f.End)
+		}
+	}
+
+	if w.daily {
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		// the window may have opened yesterday and run past midnight
+		for _, day := range []time.Time{midnight.AddDate(0, 0, -1), midnight} {
+			open := day.Add(w.start)
+			if !t.Before(open) && t.Before(open.Add(w.duration)) {
+				return ""
+			}
+		}
+		return fmt.Sprintf("outside the daily maintenance window %s UTC for %s", fmtClock(w.start), w.duration)
+	}
+
+	return ""
+}
+
+// Next returns the first time from t on when the cluster may be changed
+func (w *Window) Next(t time.Time) (time.Time, bool) {
+	t = t.UTC()
+	limit := t.AddDate(1, 0, 0)
+
+	for t.Before(limit) {
+		if w.Blocked(t) == "" {
+			return t, true
+		}
+
+		moved := false
+		for _, f := range w.freezes {
+			if !t.Before(f.start) && t.Before(f.end) {
+				t, moved = f.end, true
+				break
+			}
+		}
+		if moved {
+			continue
+		}
+
+		open := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Add(w.start)
+		if !open.After(t) {
+			open = open.AddDate(0, 0, 1)
+		}
+		t = open
+	}
+
+	return time.Time{}, false
+}
+
+func fmtClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,127 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindow(t *testing.T) {
+	cal := &Calendar{Freezes: []Freeze{
+		{Start: "2018-12-20", End: "2018-12-21", Reason: "holidays"},
+		{Start: "2018-11-23T00:00:00Z", End: "2018-11-27T00:00:00Z", Clusters: []string{"prod"}, Reason: "sales"},
+	}}
+	if err := cal.parse(); err != nil {
+		t.Fatal(err)
+	}
+	at := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2018, month, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name            string
+		cluster         string
+		start, duration string
+		now             time.Time
+		blocked         bool
+		next            time.Time
+	}{
+		{
+			name:    "no window, no freeze",
+			cluster: "prod",
+			now:     at(11, 1, 12, 0),
+			next:    at(11, 1, 12, 0),
+		},
+		{
+			name:     "inside the daily window",
+			cluster:  "prod",
+			start:    "03:00",
+			duration: "PT4H0M0S",
+			now:      at(11, 1, 5, 0),
+			next:     at(11, 1, 5, 0),
+		},
+		{
+			name:     "before the daily window",
+			cluster:  "prod",
+			start:    "03:00",
+			duration: "PT4H0M0S",
+			now:      at(11, 1, 1, 0),
+			blocked:  true,
+			next:     at(11, 1, 3, 0),
+		},
+		{
+			name:     "after the daily window",
+			cluster:  "prod",
+			start:    "03:00",
+			duration: "PT4H",
+			now:      at(11, 1, 7, 0),
+			blocked:  true,
+			next:     at(11, 2, 3, 0),
+		},
+		{
+			name:     "a window past midnight",
+			cluster:  "prod",
+			start:    "22:00",
+			duration: "PT4H",
+			now:      at(11, 2, 1, 30),
+			next:     at(11, 2, 1, 30),
+		},
+		{
+			name:    "the end day of a freeze is included",
+			cluster: "staging",
+			now:     at(12, 21, 23, 0),
+			blocked: true,
+			next:    at(12, 22, 0, 0),
+		},
+		{
+			name:    "a freeze of another cluster",
+			cluster: "staging",
+			now:     at(11, 24, 12, 0),
+			next:    at(11, 24, 12, 0),
+		},
+		{
+			name:     "the window after a freeze",
+			cluster:  "prod",
+			start:    "03:00",
+			duration: "PT4H",
+			now:      at(11, 24, 4, 0),
+			blocked:  true,
+			next:     at(11, 27, 3, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		w, err := NewWindow(tt.cluster, tt.start, tt.duration, cal)
+		if err != nil {
+			t.Errorf("%s: NewWindow() error = %v", tt.name, err)
+			continue
+		}
+		if reason := w.Blocked(tt.now); (reason != "") != tt.blocked {
+			t.Errorf("%s: Blocked() = %q, want blocked %t", tt.name, reason, tt.blocked)
+		}
+		if next, ok := w.Next(tt.now); !ok || !next.Equal(tt.next) {
+			t.Errorf("%s: Next() = %s, %t, want %s", tt.name, next, ok, tt.next)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT4H0M0S", 4 * time.Hour, false},
+		{"PT4H", 4 * time.Hour, false},
+		{"PT1H30M", 90 * time.Minute, false},
+		{"PT45S", 45 * time.Second, false},
+		{"P1D", 0, true},
+		{"4h", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseISODuration(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseISODuration(%q) = %s, %v, want %s, wantErr %t", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package operations follows GKE operations and finds those blocking an
+// upgrade. It is shared by the tools, so it works on Operation, the fields it
+// needs of the operations of the container/v1 client each tool vendors, and
+// calls the API through the functions the tools pass in.
+package operations
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+const (
+	minPollInterval = 2 * time.Second
+	maxPollInterval = 30 * time.Second
+)
+
+// ErrDetached is returned when the user stops following an operation with
+// Ctrl-C; the operation itself keeps running
+var ErrDetached = errors.New("detached from operation")
+
+// Operation is a GKE operation
+type Operation struct {
+	Name          string
+	OperationType string
+	Status        string
+	Detail        string
+	StatusMessage string
+	TargetLink    string
+	SelfLink      string
+}
+
+// Getter gets an operation of the zone by name
+type Getter func(name string) (*Operation, error)
+
+// Lister lists the operations of the zone
+type Lister func() ([]*Operation, error)
+
+// Follow polls the operation with backoff until it is DONE, printing its
+// progress. It gives up after timeout and detaches on Ctrl-C.
+func Follow(get Getter, name string, timeout time.Duration) (*Operation, error) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	start := time.Now()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	interval := minPollInterval
+	var last string
+
+	for {
+		op, err := get(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get operation %s: %v", name, err)
+		}
+
+		elapsed := time.Since(start).Truncate(time.Second)
+		progress := fmt.Sprintf("%s %s", op.Status, op.Detail)
+		if op.StatusMessage != "" {
+			progress += ": " + op.StatusMessage
+		}
+		if progress != last {
+			fmt.Printf("[%s] Operation %s (%s) %s\n", elapsed, op.Name, op.OperationType, progress)
+			last = progress
+		}
+
+		if op.Status == "DONE" {
+			// a finished operation only carries a status message on failure
+			if op.StatusMessage != "" {
+				return op, fmt.Errorf("operation %s failed after %s: %s", op.Name, elapsed, op.StatusMessage)
+			}
+			fmt.Printf("Operation %s done in %s\n", op.Name, elapsed)
+			return op, nil
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-deadline.C:
+			return op, fmt.Errorf("timed out after %s, operation %s is still %s", timeout, op.Name, op.Status)
+		case <-interrupt:
+			fmt.Printf("Detached, operation %s keeps running; follow it with: wait-op %s\n", op.Name, op.Name)
+			return op, ErrDetached
+		}
+
+		interval *= 2
+		if interval > maxPollInterval {
+			interval = maxPollInterval
+		}
+	}
+}
+
+// Wait is the wait-op command: it follows an operation started elsewhere
+func Wait(get Getter, name string, timeout time.Duration) error {
+	if name == "" {
+		return errors.New("usage: wait-op <operation id>")
+	}
+
+	_, err := Follow(get, name, timeout)
+	if err == ErrDetached {
+		return nil
+	}
+	return err
+}
+
+// nonBlockingOps only touch the node pool they target, work on another pool
+// of the same cluster can go ahead while they run
+var nonBlockingOps = map[string]bool{
+	"SET_NODE_POOL_SIZE":       true,
+	"SET_NODE_POOL_MANAGEMENT": true,
+	"AUTO_REPAIR_NODES":        true,
+	"SET_LABELS":               true,
+}
+
+// linkTarget returns the cluster and node pool an operation link points to,
+// e.g. .../zones/us-central1-a/clusters/prod/nodePools/default-pool
+func linkTarget(link string) (cluster, nodePool string) {
+	parts := strings.Split(link, "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "clusters":
+			cluster = parts[i+1]
+		case "nodePools":
+			nodePool = parts[i+1]
+		}
+	}
+	return cluster, nodePool
+}
+
+// Blocking returns the unfinished operations of ops that must finish before
+// the master of the cluster (nodePoolID "") or one of its node pools can be
+// upgraded. Operations of other clusters in the zone are ignored.
+func Blocking(ops []*Operation, clusterID, nodePoolID string) []*Operation {
+	blocking := make([]*Operation, 0)
+
+	for _, op := range ops {
+		if op.Status == "DONE" {
+			continue
+		}
+
+		cluster, nodePool := linkTarget(op.TargetLink)
+		if cluster == "" {
+			cluster, nodePool = linkTarget(op.SelfLink)
+		}
+		if cluster != clusterID {
+			continue
+		}
+
+		if nodePoolID != "" && nodePool != "" && nodePool != nodePoolID && nonBlockingOps[op.OperationType] {
+			fmt.Printf("Operation in progress id: %s, type: %s, node pool: %s, not blocking\n", op.Name, op.OperationType, nodePool)
+			continue
+		}
+
+		blocking = append(blocking, op)
+	}
+
+	return blocking
+}
+
+// WaitForBlocking lists the blocking operations and, with wait, follows them
+// until none is left. Without wait it reports whether there were none.
+func WaitForBlocking(list Lister, get Getter, clusterID, nodePoolID string, wait bool, timeout time.Duration) (bool, error) {
+	for {
+		all, err := list()
+		if err != nil {
+			return false, err
+		}
+		ops := Blocking(all, clusterID, nodePoolID)
+		if len(ops) == 0 {
+			return true, nil
+		}
+
+		for _, op := range ops {
+			fmt.Printf("Operation in progress id: %s, type: %s, status: %s\n", op.Name, op.OperationType, op.Status)
+		}
+		if !wait {
+			return false, nil
+		}
+
+		for _, op := range ops {
+			done, err := Follow(get, op.Name, timeout)
+			switch {
+			case err == ErrDetached:
+				return false, nil
+			case err != nil && (done == nil || done.Status != "DONE"):
+				return false, err
+			case err != nil:
+				// a failed blocking operation no longer blocks
+				log.Printf("Blocking operation %s: %v", op.Name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package operations
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBlocking(t *testing.T) {
+	const zone = "https://container.googleapis.com/v1/projects/123/zones/europe-west1-b"
+	ops := []*Operation{
+		{Name: "upgrade-master", OperationType: "UPGRADE_MASTER", Status: "RUNNING", TargetLink: zone + "/clusters/prod"},
+		{Name: "resize-batch", OperationType: "SET_NODE_POOL_SIZE", Status: "RUNNING", TargetLink: zone + "/clusters/prod/nodePools/batch"},
+		{Name: "upgrade-batch", OperationType: "UPGRADE_NODES", Status: "RUNNING", TargetLink: zone + "/clusters/prod/nodePools/batch"},
+		{Name: "done", OperationType: "UPGRADE_NODES", Status: "DONE", TargetLink: zone + "/clusters/prod/nodePools/batch"},
+		{Name: "staging", OperationType: "UPGRADE_MASTER", Status: "RUNNING", TargetLink: zone + "/clusters/staging"},
+		{Name: "self-link", OperationType: "SET_LABELS", Status: "PENDING", SelfLink: zone + "/clusters/prod/nodePools/web"},
+	}
+
+	tests := []struct {
+		nodePoolID string
+		want       []string
+	}{
+		{"", []string{"upgrade-master", "resize-batch", "upgrade-batch", "self-link"}},
+		{"batch", []string{"upgrade-master", "resize-batch", "upgrade-batch"}},
+		{"web", []string{"upgrade-master", "upgrade-batch", "self-link"}},
+	}
+
+	for _, tt := range tests {
+		got := make([]string, 0)
+		for _, op := range Blocking(ops, "prod", tt.nodePoolID) {
+			got = append(got, op.Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Blocking(prod, %q) = %v, want %v", tt.nodePoolID, got, tt.want)
+		}
+	}
+}
+
+func TestLinkTarget(t *testing.T) {
+	tests := []struct {
+		link, cluster, nodePool string
+	}{
+		{"projects/p/zones/z/clusters/prod/nodePools/batch", "prod", "batch"},
+		{"projects/p/zones/z/clusters/prod", "prod", ""},
+		{"projects/p/zones/z/operations/op-1", "", ""},
+		{"", "", ""},
+	}
+
+	for _, tt := range tests {
+		cluster, nodePool := linkTarget(tt.link)
+		if cluster != tt.cluster || nodePool != tt.nodePool {
+			t.Errorf("linkTarget(%q) = %q, %q, want %q, %q", tt.link, cluster, nodePool, tt.cluster, tt.nodePool)
+		}
+	}
+}
+
+// statuses returns a Getter answering with the statuses in turn, the last
+// one for good
+func statuses(t *testing.T, msg string, s ...string) Getter {
+	return func(name string) (*Operation, error) {
+		if name != "op-1" {
+			t.Errorf("get(%s), want op-1", name)
+		}
+		op := &Operation{Name: name, Status: s[0]}
+		if len(s) > 1 {
+			s = s[1:]
+		} else {
+			op.StatusMessage = msg
+		}
+		return op, nil
+	}
+}
+
+func TestFollow(t *testing.T) {
+	tests := []struct {
+		name    string
+		get     Getter
+		timeout time.Duration
+		status  string
+		wantErr bool
+	}{
+		{
+			name:    "done",
+			get:     statuses(t, "", "RUNNING", "DONE"),
+			timeout: time.Minute,
+			status:  "DONE",
+		},
+		{
+			name:    "failed",
+			get:     statuses(t, "node pool not found", "DONE"),
+			timeout: time.Minute,
+			status:  "DONE",
+			wantErr: true,
+		},
+		{
+			name:    "timed out",
+			get:     statuses(t, "", "RUNNING"),
+			timeout: time.Millisecond,
+			status:  "RUNNING",
+			wantErr: true,
+		},
+		{
+			name:    "get fails",
+			get:     func(string) (*Operation, error) { return nil, errors.New("forbidden") },
+			timeout: time.Minute,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		op, err := Follow(tt.get, "op-1", tt.timeout)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Follow() error = %v, wantErr %t", tt.name, err, tt.wantErr)
+			continue
+		}
+		status := ""
+		if op != nil {
+			status = op.Status
+		}
+		if status != tt.status {
+			t.Errorf("%s: Follow() status = %q, want %q", tt.name, status, tt.status)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Package pricing estimates what GKE nodes cost from the local, versioned
+// price list in gke/pricing.json. It is shared by the tools, so it only takes
+// plain values, not the API types each tool vendors.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// DefaultDiskType is the boot disk of nodes that don't set one
+	DefaultDiskType = "pd-standard"
+	// DefaultDiskSizeGb is the boot disk size of nodes that don't set one
+	DefaultDiskSizeGb = 100
+	// LocalSsdSizeGb is the size of every local SSD attached to a node
+	LocalSsdSizeGb = 375
+)
+
+// Table is pricing.json. Machine prices are per hour, disk prices per GB and
+// month.
+type Table struct {
+	Version       string                   `json:"version"`
+	Currency      string                   `json:"currency"`
+	HoursPerMonth float64                  `json:"hoursPerMonth"`
+	Regions       map[string]regionPricing `json:"regions"`
+}
+
+type regionPricing struct {
+	MachineTypes map[string]price   `json:"machineTypes"`
+	Disks        map[string]float64 `json:"disks"`
+	LocalSsd     price              `json:"localSsd"`
+}
+
+type price struct {
+	OnDemand    float64 `json:"onDemand"`
+	Preemptible float64 `json:"preemptible"`
+}
+
+func (p price) of(preemptible bool) float64 {
+	if preemptible {
+		return p.Preemptible
+	}
+	return p.OnDemand
+}
+
+// Node is the part of a node config that its price depends on
+type Node struct {
+	MachineType   string
+	DiskType      string
+	DiskSizeGb    int64
+	LocalSsdCount int64
+	Preemptible   bool
+}
+
+// Path returns path, or when it is empty the pricing.json next to the
+// executable or in its parent directory, where it is in this repository
+func Path(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find pricing.json, set --pricing: %v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", fmt.Errorf("failed to find pricing.json, set --pricing: %v", err)
+	}
+
+	dir := filepath.Dir(exe)
+	candidates := []string{
+		filepath.Join(dir, "pricing.json"),
+		filepath.Join(dir, "..", "pricing.json"),
+	}
+	for _, c := range candidates {
+		if _, err := os.Stat(c); err == nil {
+			return c, nil
+		}
+	}
+
+	return "", fmt.Errorf("no pricing.json in %s or its parent directory, set --pricing", dir)
+}
+
+// Load reads the table at path, see Path
+func Load(path string) (*Table, error) {
+	path, err := Path(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Table
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if t.HoursPerMonth == 0 {
+		return nil, fmt.Errorf("%s: hoursPerMonth is not set", path)
+	}
+
+	return &t, nil
+}
+
+// NodeHourly returns the hourly price of one node
+func (t *Table) NodeHourly(region string, n Node) (float64, error) {
+	rp, ok := t.Regions[region]
+	if !ok {
+		return 0, fmt.Errorf("pricing %s has no prices for region %s", t.Version, region)
+	}
+
+	mp, ok := rp.MachineTypes[n.MachineType]
+	if !ok {
+		return 0, fmt.Errorf("pricing %s has no price for %s in %s", t.Version, n.MachineType, region)
+	}
+
+	diskType := n.DiskType
+	if diskType == "" {
+		diskType = DefaultDiskType
+	}
+	dp, ok := rp.Disks[diskType]
+	if !ok {
+		return 0, fmt.Errorf("pricing %s has no price for %s disks in %s", t.Version, diskType, region)
+	}
+
+	diskSize := n.DiskSizeGb
+	if diskSize == 0 {
+		diskSize = DefaultDiskSizeGb
+	}
+
+	monthly := float64(diskSize)*dp + float64(n.LocalSsdCount*LocalSsdSizeGb)*rp.LocalSsd.of(n.Preemptible)
+
+	return mp.of(n.Preemptible) + monthly/t.HoursPerMonth, nil
+}
+
+// PrintCostDelta prints what adding nodes costs. Pricing problems are
+// reported but don't stop the change.
+func PrintCostDelta(path, region string, n Node, nodes int64) {
+	t, err := Load(path)
+	if err != nil {
+		fmt.Printf("no cost estimate: %v\n", err)
+		return
+	}
+
+	hourly, err := t.NodeHourly(region, n)
+	if err != nil {
+		fmt.Printf("no cost estimate: %v\n", err)
+		return
+	}
+
+	fmt.Printf("cost delta for %+d x %s (pricing %s): %+.2f %s/hour, %+.2f %s/month\n",
+		nodes, n.MachineType, t.Version,
+		hourly*float64(nodes), t.Currency, hourly*float64(nodes)*t.HoursPerMonth, t.Currency)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pondohva/golang-samples/gke/versions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// apiRemoval is a resource that stops being served under a group/version in
+// the minor release removedIn
+type apiRemoval struct {
+	removedIn    versions.Minor
+	groupVersion string
+	resource     string
+	replacement  string
+}
+
+func minor(major, minor int) versions.Minor {
+	return versions.Minor{Major: major, Minor: minor}
+}
+
+// apiRemovals is the bundled table of removed API versions
+var apiRemovals = []apiRemoval{
+	{minor(1, 16), "extensions/v1beta1", "deployments", "apps/v1"},
+	{minor(1, 16), "extensions/v1beta1", "daemonsets", "apps/v1"},
+	{minor(1, 16), "extensions/v1beta1", "replicasets", "apps/v1"},
+	{minor(1, 16), "extensions/v1beta1", "networkpolicies", "networking.k8s.io/v1"},
+	{minor(1, 16), "extensions/v1beta1", "podsecuritypolicies", "policy/v1beta1"},
+	{minor(1, 16), "apps/v1beta1", "deployments", "apps/v1"},
+	{minor(1, 16), "apps/v1beta1", "statefulsets", "apps/v1"},
+	{minor(1, 16), "apps/v1beta2", "deployments", "apps/v1"},
+	{minor(1, 16), "apps/v1beta2", "daemonsets", "apps/v1"},
+	{minor(1, 16), "apps/v1beta2", "replicasets", "apps/v1"},
+	{minor(1, 16), "apps/v1beta2", "statefulsets", "apps/v1"},
+	{minor(1, 22), "admissionregistration.k8s.io/v1beta1", "mutatingwebhookconfigurations", "admissionregistration.k8s.io/v1"},
+	{minor(1, 22), "admissionregistration.k8s.io/v1beta1", "validatingwebhookconfigurations", "admissionregistration.k8s.io/v1"},
+	{minor(1, 22), "apiextensions.k8s.io/v1beta1", "customresourcedefinitions", "apiextensions.k8s.io/v1"},
+	{minor(1, 22), "apiregistration.k8s.io/v1beta1", "apiservices", "apiregistration.k8s.io/v1"},
+	{minor(1, 22), "certificates.k8s.io/v1beta1", "certificatesigningrequests", "certificates.k8s.io/v1"},
+	{minor(1, 22), "coordination.k8s.io/v1beta1", "leases", "coordination.k8s.io/v1"},
+	{minor(1, 22), "extensions/v1beta1", "ingresses", "networking.k8s.io/v1"},
+	{minor(1, 22), "networking.k8s.io/v1beta1", "ingresses", "networking.k8s.io/v1"},
+	{minor(1, 22), "networking.k8s.io/v1beta1", "ingressclasses", "networking.k8s.io/v1"},
+	{minor(1, 22), "rbac.authorization.k8s.io/v1beta1", "roles", "rbac.authorization.k8s.io/v1"},
+	{minor(1, 22), "rbac.authorization.k8s.io/v1beta1", "rolebindings", "rbac.authorization.k8s.io/v1"},
+	{minor(1, 22), "rbac.authorization.k8s.io/v1beta1", "clusterroles", "rbac.authorization.k8s.io/v1"},
+	{minor(1, 22), "rbac.authorization.k8s.io/v1beta1", "clusterrolebindings", "rbac.authorization.k8s.io/v1"},
+	{minor(1, 22), "scheduling.k8s.io/v1beta1", "priorityclasses", "scheduling.k8s.io/v1"},
+	{minor(1, 22), "storage.k8s.io/v1beta1", "csidrivers", "storage.k8s.io/v1"},
+	{minor(1, 22), "storage.k8s.io/v1beta1", "csinodes", "storage.k8s.io/v1"},
+	{minor(1, 22), "storage.k8s.io/v1beta1", "storageclasses", "storage.k8s.io/v1"},
+	{minor(1, 22), "storage.k8s.io/v1beta1", "volumeattachments", "storage.k8s.io/v1"},
+	{minor(1, 25), "batch/v1beta1", "cronjobs", "batch/v1"},
+	{minor(1, 25), "discovery.k8s.io/v1beta1", "endpointslices", "discovery.k8s.io/v1"},
+	{minor(1, 25), "events.k8s.io/v1beta1", "events", "events.k8s.io/v1"},
+	{minor(1, 25), "autoscaling/v2beta1", "horizontalpodautoscalers", "autoscaling/v2"},
+	{minor(1, 25), "policy/v1beta1", "poddisruptionbudgets", "policy/v1"},
+	{minor(1, 25), "policy/v1beta1", "podsecuritypolicies", ""},
+	{minor(1, 25), "node.k8s.io/v1beta1", "runtimeclasses", "node.k8s.io/v1"},
+	{minor(1, 26), "autoscaling/v2beta2", "horizontalpodautoscalers", "autoscaling/v2"},
+	{minor(1, 26), "flowcontrol.apiserver.k8s.io/v1beta1", "flowschemas", "flowcontrol.apiserver.k8s.io/v1"},
+	{minor(1, 26), "flowcontrol.apiserver.k8s.io/v1beta1", "prioritylevelconfigurations", "flowcontrol.apiserver.k8s.io/v1"},
+	{minor(1, 27), "storage.k8s.io/v1beta1", "csistoragecapacities", "storage.k8s.io/v1"},
+	{minor(1, 29), "flowcontrol.apiserver.k8s.io/v1beta2", "flowschemas", "flowcontrol.apiserver.k8s.io/v1"},
+	{minor(1, 29), "flowcontrol.apiserver.k8s.io/v1beta2", "prioritylevelconfigurations", "flowcontrol.apiserver.k8s.io/v1"},
+	{minor(1, 32), "flowcontrol.apiserver.k8s.io/v1beta3", "flowschemas", "flowcontrol.apiserver.k8s.io/v1"},
+	{minor(1, 32), "flowcontrol.apiserver.k8s.io/v1beta3", "prioritylevelconfigurations", "flowcontrol.apiserver.k8s.io/v1"},
+}
+
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// deprecatedObject is a live object that is written with a removed API
+// version, or for which that is unknown
+type deprecatedObject struct {
+	removal   apiRemoval
+	namespace string
+	name      string
+	unknown   bool
+}
+
+func (o deprecatedObject) String() string {
+	name := o.name
+	if o.namespace != "" {
+		name = o.namespace + "/" + name
+	}
+	replacement := o.removal.replacement
+	if replacement == "" {
+		replacement = "no replacement"
+	}
+	if o.unknown {
+		return fmt.Sprintf("%s %s: unknown whether it uses %s removed in %s (no managed fields or last applied configuration), use %s",
+			o.removal.resource, name, o.removal.groupVersion, o.removal.removedIn, replacement)
+	}
+	return fmt.Sprintf("%s %s: %s removed in %s, use %s",
+		o.removal.resource, name, o.removal.groupVersion, o.removal.removedIn, replacement)
+}
+
+// objectList is the part of a list response the scan looks at. The vendored
+// ObjectMeta predates managed fields, so they are decoded here.
+type objectList struct {
+	Items []struct {
+		Metadata struct {
+			metav1.ObjectMeta
+			ManagedFields []struct {
+				APIVersion string `json:"apiVersion"`
+			} `json:"managedFields"`
+		} `json:"metadata"`
+	} `json:"items"`
+}
+
+// findDeprecatedObjects returns the objects that use API versions removed
+// after the current and up to the target master version. The list returns
+// every object in the removed version, so an object counts when a manager
+// of its managed fields wrote it in that version, or without managed fields
+// when its last applied configuration names it. Objects with neither are
+// returned as unknown.
+func findDeprecatedObjects(kc *kubernetes.Clientset, current, target string) ([]deprecatedObject, error) {
+	cur, err := versions.Parse(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse current version %s: %v", current, err)
+	}
+	tgt, err := versions.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target version %s: %v", target, err)
+	}
+	curMinor, tgtMinor := cur.Minor(), tgt.Minor()
+
+	groups, err := kc.Discovery().ServerGroups()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover API groups: %v", err)
+	}
+
+	served := make(map[string]bool)
+	for _, g := range groups.Groups {
+		for _, v := range g.Versions {
+			served[v.GroupVersion] = true
+		}
+	}
+
+	var found []deprecatedObject
+
+	for _, r := range apiRemovals {
+		if !curMinor.Less(r.removedIn) || tgtMinor.Less(r.removedIn) || !served[r.groupVersion] {
+			continue
+		}
+
+		raw, err := kc.Discovery().RESTClient().Get().AbsPath("/apis", r.groupVersion, r.resource).Do().Raw()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s %s: %v", r.groupVersion, r.resource, err)
+		}
+
+		var list objectList
+		if err := json.Unmarshal(raw, &list); err != nil {
+			return nil, fmt.Errorf("failed to parse %s %s: %v", r.groupVersion, r.resource, err)
+		}
+
+		for _, item := range list.Items {
+			meta := item.Metadata
+			o := deprecatedObject{removal: r, namespace: meta.Namespace, name: meta.Name}
+
+			switch {
+			case len(meta.ManagedFields) > 0:
+				for _, f := range meta.ManagedFields {
+					if f.APIVersion == r.groupVersion {
+						found = append(found, o)
+						break
+					}
+				}
+			case meta.Annotations[lastAppliedAnnotation] != "":
+				if lastAppliedVersion(meta.Annotations) == r.groupVersion {
+					found = append(found, o)
+				}
+			default:
+				o.unknown = true
+				found = append(found, o)
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].String() < found[j].String() })
+
+	return found, nil
+}
+
+func lastAppliedVersion(annotations map[string]string) string {
+	applied, ok := annotations[lastAppliedAnnotation]
+	if !ok {
+		return ""
+	}
+
+	var obj struct {
+		APIVersion string `json:"apiVersion"`
+	}
+	if err := json.Unmarshal([]byte(applied), &obj); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(obj.APIVersion)
+}
+
+// checkDeprecatedAPIs blocks an upgrade to target while objects use, or may
+// use, API versions it no longer serves, unless they are acknowledged
+func checkDeprecatedAPIs(kc *kubernetes.Clientset, current, target string) error {
+	found, err := findDeprecatedObjects(kc, current, target)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		fmt.Printf("No objects use API versions removed by %s\n", target)
+		return nil
+	}
+
+	fmt.Printf("Objects using or possibly using API versions removed by %s:\n", target)
+	for _, o := range found {
+		fmt.Printf("\t%s\n", o)
+	}
+
+	if *ackDeprecations {
+		fmt.Printf("%d objects acknowledged with --ack-deprecated-apis\n", len(found))
+		return nil
+	}
+
+	return fmt.Errorf("%d objects use or may use API versions removed by %s; migrate them or pass --ack-deprecated-apis", len(found), target)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const healthPollInterval = 15 * time.Second
+
+// healthProblems returns why the cluster is not healthy: nodes that are not
+// Ready and pods in CrashLoopBackOff in the namespaces (all namespaces when
+// none are given)
+func healthProblems(kc *kubernetes.Clientset, namespaces []string) ([]string, error) {
+	var problems []string
+
+	nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v", err)
+	}
+	for i := range nodes.Items {
+		n := &nodes.Items[i]
+		if !nodeReady(n) {
+			problems = append(problems, fmt.Sprintf("node %s is not Ready", n.Name))
+		}
+	}
+
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	for _, ns := range namespaces {
+		pods, err := kc.CoreV1().Pods(ns).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %v", err)
+		}
+		for _, p := range pods.Items {
+			for _, cs := range p.Status.ContainerStatuses {
+				if w := cs.State.Waiting; w != nil && w.Reason == "CrashLoopBackOff" {
+					problems = append(problems, fmt.Sprintf("pod %s/%s container %s is in CrashLoopBackOff", p.Namespace, p.Name, cs.Name))
+				}
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+func nodeReady(n *v1.Node) bool {
+	for _, c := range n.Status.Conditions {
+		if c.Type == v1.NodeReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// waitHealthy polls the cluster until it has no health problems, and fails
+// with the last ones after timeout
+func waitHealthy(kc *kubernetes.Clientset, name string, namespaces []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		problems, err := healthProblems(kc, namespaces)
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			fmt.Printf("Cluster %q is healthy\n", name)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			for _, p := range problems {
+				fmt.Printf("\t%s\n", p)
+			}
+			return fmt.Errorf("cluster %q still unhealthy after %s: %d problems", name, timeout, len(problems))
+		}
+
+		fmt.Printf("Cluster %q not healthy yet (%d problems, first: %s)\n", name, len(problems), problems[0])
+		time.Sleep(healthPollInterval)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/api/container/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+var kubeconfig = flag.String("kubeconfig", defaultKubeconfig(), "(optional) absolute path to the kubeconfig file")
+
+func GetConfigInCluster() (*restclient.Config, error) {
+	config, err := restclient.InClusterConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func GetConfigOutOfCluster() (*restclient.Config, error) {
+	config, err := clientcmd.BuildConfigFromFlags("", *kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func defaultKubeconfig() string {
+	if home := homeDir(); home != "" {
+		return filepath.Join(home, ".kube", "config")
+	}
+	return ""
+}
+
+func homeDir() string {
+	if h := os.Getenv("HOME"); h != "" {
+		return h
+	}
+	return os.Getenv("USERPROFILE") // windows
+}
+
+// NewKubeClient returns a client for the cluster of the kubeconfig, or of the
+// pod the tool runs in
+func NewKubeClient() (*kubernetes.Clientset, error) {
+	config, err := GetConfigInCluster()
+
+	if err != nil {
+		config, err = GetConfigOutOfCluster()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// NewKubeClientForContext returns a client for a context of the kubeconfig,
+// for tools that work on several clusters
+func NewKubeClientForContext(context string) (*kubernetes.Clientset, error) {
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: *kubeconfig},
+		&clientcmd.ConfigOverrides{CurrentContext: context},
+	).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(config)
+}
+
+// kubeContext is the kubeconfig context gcloud container clusters
+// get-credentials creates for a cluster
+func kubeContext(projectID, zone, clusterID string) string {
+	return fmt.Sprintf("gke_%s_%s_%s", projectID, zone, clusterID)
+}
+
+// NewKubeClientForCluster returns a client for the cluster's context of the
+// kubeconfig, or for the cluster of the pod the tool runs in when the
+// kubeconfig doesn't have it. It fails unless the nodes of the API server
+// belong to the cluster, so another cluster is caught before anything is
+// read or changed through it.
+func NewKubeClientForCluster(projectID, zone string, cl *container.Cluster) (*kubernetes.Clientset, error) {
+	context := kubeContext(projectID, zone, cl.Name)
+
+	kc, err := NewKubeClientForContext(context)
+	if err != nil {
+		config, inClusterErr := GetConfigInCluster()
+		if inClusterErr != nil {
+			return nil, fmt.Errorf("no kubeconfig context %s (%v), run gcloud container clusters get-credentials %s", context, err, cl.Name)
+		}
+		if kc, err = kubernetes.NewForConfig(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := checkClusterNodes(kc, cl); err != nil {
+		return nil, err
+	}
+	return kc, nil
+}
+
+// checkClusterNodes fails unless every node of the API server is an instance
+// of one of the node pools of the cluster. The instances of a group
+// gke-<cluster>-<pool>-<hash>-grp are named gke-<cluster>-<pool>-<hash>-<id>,
+// and the hash differs between clusters.
+func checkClusterNodes(kc *kubernetes.Clientset, cl *container.Cluster) error {
+	var prefixes []string
+	for _, np := range cl.NodePools {
+		for _, url := range np.InstanceGroupUrls {
+			name := url[strings.LastIndex(url, "/")+1:]
+			prefixes = append(prefixes, strings.TrimSuffix(name, "grp"))
+		}
+	}
+
+	nodes, err := kc.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %v", err)
+	}
+
+	if len(nodes.Items) == 0 && cl.CurrentNodeCount > 0 {
+		return fmt.Errorf("the Kubernetes API has no nodes, it isn't cluster %s", cl.Name)
+	}
+	for _, n := range nodes.Items {
+		if !hasAnyPrefix(n.Name, prefixes) {
+			return fmt.Errorf("node %s isn't in a node pool of cluster %s, the Kubernetes API is another cluster's", n.Name, cl.Name)
+		}
+	}
+
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
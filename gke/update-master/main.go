@@ -2,15 +2,30 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
-	"github.com/hashicorp/go-version"
+	"github.com/pondohva/golang-samples/gke/versions"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/container/v1"
 )
 
+var (
+	timeout    = flag.Duration("timeout", time.Hour, "how long to follow an operation")
+	waitForOps = flag.Bool("wait-for-ops", false, "wait for operations blocking the upgrade instead of exiting")
+
+	freezeCalendarFile = flag.String("freeze-calendar", "", "JSON file with periods when upgrades are frozen")
+	overrideFreeze     = flag.Bool("override-freeze", false, "upgrade outside the maintenance window or during a freeze")
+	deferUpgrade       = flag.Bool("defer-upgrade", false, "wait for the next allowed time instead of refusing to upgrade")
+
+	ackDeprecations = flag.Bool("ack-deprecated-apis", false, "upgrade even though objects use API versions the new version removes")
+
+	rolloutStateFile = flag.String("rollout-state", "rollout-state.json", "file recording the progress of rollout so it can be resumed")
+)
+
 func NewClient(ctx context.Context) (*container.Service, error) {
 	hc, err := google.DefaultClient(ctx, container.CloudPlatformScope)
 	if err != nil {
@@ -26,9 +41,24 @@ func NewClient(ctx context.Context) (*container.Service, error) {
 }
 
 func main() {
+	flag.Parse()
 	ctx := context.Background()
 	svc, err := NewClient(ctx)
 
+	if flag.Arg(0) == "rollout" {
+		if err != nil {
+			log.Fatal(err)
+		}
+		config := flag.Arg(1)
+		if config == "" {
+			config = "rollout.json"
+		}
+		if err := runRollout(svc, config, *rolloutStateFile); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	projectID, ok := os.LookupEnv("GKE_PROJECT_ID")
 	if !ok {
 		log.Fatal("set GKE_PROJECT_ID")
@@ -37,6 +67,18 @@ func main() {
 	if !ok {
 		log.Fatal("set GKE_ZONE")
 	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if flag.Arg(0) == "wait-op" {
+		if err := waitOperation(svc, projectID, zone, flag.Arg(1), *timeout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	clusterID, ok := os.LookupEnv("GKE_CLUSTER_ID")
 	if !ok {
 		log.Fatal("set GKE_CLUSTER_ID")
@@ -44,10 +86,6 @@ func main() {
 
 	forceUpdate, ok := os.LookupEnv("GKE_FORCE_UPDATE")
 
-	if err != nil {
-		log.Fatal(err)
-	}
-
 	cl, err := svc.Projects.Zones.Clusters.Get(projectID, zone, clusterID).Do()
 
 	if err != nil {
@@ -57,50 +95,85 @@ func main() {
 	fmt.Printf("Cluster %q (%s) master_version: v%s, node_count: %d\n", cl.Name, cl.Status,
 		cl.CurrentMasterVersion, cl.CurrentNodeCount)
 
+	sc, err := svc.Projects.Zones.GetServerconfig(projectID, zone).Do()
+
 	if err != nil {
-		log.Fatal("Failed to parse master version")
+		log.Fatal("failed to get server config")
 	}
 
-	ops, err := svc.Projects.Zones.Operations.List(projectID, zone).Do()
-
+	target, err := targetVersion(sc, os.Getenv("GKE_TARGET_VERSION"))
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := checkDowngrade(cl.CurrentMasterVersion, os.Getenv("GKE_TARGET_VERSION"), target); err != nil {
+		log.Fatal(err)
+	}
 
-	opsInProgress := make([]*container.Operation, 0)
-
-	for _, op := range ops.Operations {
-		if op.Status != "DONE" {
-			opsInProgress = append(opsInProgress, op)
-		}
+	path, err := versions.Plan(cl.CurrentMasterVersion, target, sc.ValidMasterVersions)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if len(opsInProgress) > 0 {
-		for _, op := range opsInProgress {
-			fmt.Printf("Operation in progress id: %s, type: %s, status: %s\n", op.Name, op.OperationType, op.Status)
+	if flag.Arg(0) == "skew" {
+		for _, v := range versions.Proposed(cl.CurrentMasterVersion, path) {
+			if err := printSkew(cl, v); err != nil {
+				log.Fatal(err)
+			}
 		}
 		return
 	}
-	sc, err := svc.Projects.Zones.GetServerconfig(projectID, zone).Do()
 
+	ready, err := waitForBlockingOperations(svc, projectID, zone, clusterID, "", *waitForOps, *timeout)
 	if err != nil {
-		log.Fatal("failed to get server config")
+		log.Fatal(err)
 	}
-
-	versionToUpdate := "latest"
-
-	latestMasterVersion, _ := version.NewVersion(sc.ValidMasterVersions[0])
-	currentMasterVersion, _ := version.NewVersion(cl.CurrentMasterVersion)
-
-	if (latestMasterVersion.Segments()[1] - currentMasterVersion.Segments()[1]) > 1 {
-		versionToUpdate = fmt.Sprintf("%d.%d", currentMasterVersion.Segments()[0], currentMasterVersion.Segments()[1]+1)
+	if !ready {
+		return
 	}
 
-	if currentMasterVersion.LessThan(latestMasterVersion) {
+	if len(path) > 0 {
+		versionToUpdate := path[0]
+
+		fmt.Printf("Upgrade path from %s to %s:\n", cl.CurrentMasterVersion, target)
+		for i, v := range path {
+			fmt.Printf("\t%d. %s\n", i+1, v)
+		}
 
 		fmt.Printf("Available version: %s, current version: %s\n", versionToUpdate, cl.CurrentMasterVersion)
 
+		skewErr := checkSkew(cl, versionToUpdate)
+		if skewErr != nil {
+			fmt.Printf("Warning: %v\n", skewErr)
+		}
+
 		if len(forceUpdate) > 0 {
+			if skewErr != nil {
+				log.Fatalf("%v; upgrade the node pools first", skewErr)
+			}
+
+			current := cl.CurrentMasterVersion
+			if cl, err = enforceUpgradeWindow(svc, cl, projectID, zone, ""); err != nil {
+				if err == errDetached {
+					return
+				}
+				log.Fatal(err)
+			}
+			if cl.CurrentMasterVersion != current {
+				log.Fatalf("master of %q changed from %s to %s while deferred, run again", cl.Name, current, cl.CurrentMasterVersion)
+			}
+			if err := checkSkew(cl, versionToUpdate); err != nil {
+				log.Fatalf("%v; upgrade the node pools first", err)
+			}
+
+			kc, err := NewKubeClientForCluster(projectID, zone, cl)
+			if err != nil {
+				log.Fatalf("failed to create kubernetes client: %v", err)
+			}
+
+			if err := checkDeprecatedAPIs(kc, cl.CurrentMasterVersion, versionToUpdate); err != nil {
+				log.Fatal(err)
+			}
+
 			upRequest := container.UpdateClusterRequest{
 				Name: fmt.Sprintf("projects/%s/locations/%s/clusters/%s", projectID, zone, clusterID),
 				Update: &container.ClusterUpdate{
@@ -115,11 +188,14 @@ func main() {
 			}
 
 			fmt.Printf("We're going to %s, status %s, id: %s\n", op.OperationType, op.Status, op.Name)
+
+			if _, err := followOperation(svc, projectID, zone, op.Name, *timeout); err != nil && err != errDetached {
+				log.Fatal(err)
+			}
 		}
 
 	} else {
-		fmt.Printf("Already latest version %s\n", currentMasterVersion)
+		fmt.Printf("Already latest version %s\n", cl.CurrentMasterVersion)
 	}
 
 }
-
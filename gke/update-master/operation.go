@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pondohva/golang-samples/gke/operations"
+	"google.golang.org/api/container/v1"
+)
+
+// errDetached is returned when the user stops following an operation with
+// Ctrl-C; the operation itself keeps running
+var errDetached = operations.ErrDetached
+
+// operation is the part of the operation the operations package works on
+func operation(op *container.Operation) *operations.Operation {
+	return &operations.Operation{
+		Name:          op.Name,
+		OperationType: op.OperationType,
+		Status:        op.Status,
+		Detail:        op.Detail,
+		StatusMessage: op.StatusMessage,
+		TargetLink:    op.TargetLink,
+		SelfLink:      op.SelfLink,
+	}
+}
+
+func operationGetter(svc *container.Service, projectID, zone string) operations.Getter {
+	return func(name string) (*operations.Operation, error) {
+		op, err := svc.Projects.Zones.Operations.Get(projectID, zone, name).Do()
+		if err != nil {
+			return nil, err
+		}
+		return operation(op), nil
+	}
+}
+
+// followOperation polls the operation until it is DONE, printing its
+// progress. It gives up after timeout and detaches on Ctrl-C.
+func followOperation(svc *container.Service, projectID, zone, name string, timeout time.Duration) (*operations.Operation, error) {
+	return operations.Follow(operationGetter(svc, projectID, zone), name, timeout)
+}
+
+// waitOperation is the wait-op command: it follows an operation started
+// elsewhere
+func waitOperation(svc *container.Service, projectID, zone, name string, timeout time.Duration) error {
+	return operations.Wait(operationGetter(svc, projectID, zone), name, timeout)
+}
+
+// waitForBlockingOperations lists the operations blocking an upgrade of the
+// master of the cluster (nodePoolID "") or of one of its node pools and, with
+// wait, follows them until none is left. Without wait it reports whether there
+// were none.
+func waitForBlockingOperations(svc *container.Service, projectID, zone, clusterID, nodePoolID string, wait bool, timeout time.Duration) (bool, error) {
+	list := func() ([]*operations.Operation, error) {
+		ops, err := svc.Projects.Zones.Operations.List(projectID, zone).Do()
+		if err != nil {
+			return nil, err
+		}
+		all := make([]*operations.Operation, 0, len(ops.Operations))
+		for _, op := range ops.Operations {
+			all = append(all, operation(op))
+		}
+		return all, nil
+	}
+	return operations.WaitForBlocking(list, operationGetter(svc, projectID, zone), clusterID, nodePoolID, wait, timeout)
+}
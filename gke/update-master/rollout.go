@@ -0,0 +1,453 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/pondohva/golang-samples/gke/versions"
+	"google.golang.org/api/container/v1"
+)
+
+// rolloutConfig upgrades clusters wave by wave, e.g.
+//
+//	{
+//		"target": "latest",
+//		"soak": "24h",
+//		"healthTimeout": "15m",
+//		"namespaces": ["default", "payments"],
+//		"waves": [
+//			{"name": "canary", "clusters": [{"cluster": "dev"}]},
+//			{"name": "staging", "clusters": [{"cluster": "staging"}]},
+//			{"name": "prod", "clusters": [
+//				{"cluster": "prod-eu", "zone": "europe-west1-b"},
+//				{"cluster": "prod-us", "zone": "us-central1-a", "context": "prod-us"}
+//			]}
+//		]
+//	}
+//
+// target works like GKE_TARGET_VERSION and is resolved once, so every wave
+// lands on the version the canary was tested with. Project and zone default to
+// GKE_PROJECT_ID and GKE_ZONE, the kubeconfig context to the one gcloud
+// creates for the cluster.
+type rolloutConfig struct {
+	Target        string        `json:"target"`
+	Soak          string        `json:"soak"`
+	HealthTimeout string        `json:"healthTimeout"`
+	Namespaces    []string      `json:"namespaces"`
+	Waves         []rolloutWave `json:"waves"`
+
+	soak, healthTimeout time.Duration
+}
+
+type rolloutWave struct {
+	Name     string           `json:"name"`
+	Clusters []rolloutCluster `json:"clusters"`
+}
+
+type rolloutCluster struct {
+	Project string `json:"project"`
+	Zone    string `json:"zone"`
+	Cluster string `json:"cluster"`
+	Context string `json:"context"`
+}
+
+func (c rolloutCluster) String() string {
+	return fmt.Sprintf("%s/%s/%s", c.Project, c.Zone, c.Cluster)
+}
+
+func loadRolloutConfig(path string) (*rolloutConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg rolloutConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+
+	if cfg.soak, err = parseOptionalDuration(cfg.Soak, 0); err != nil {
+		return nil, fmt.Errorf("%s: soak: %v", path, err)
+	}
+	if cfg.healthTimeout, err = parseOptionalDuration(cfg.HealthTimeout, 15*time.Minute); err != nil {
+		return nil, fmt.Errorf("%s: healthTimeout: %v", path, err)
+	}
+	if len(cfg.Waves) == 0 {
+		return nil, fmt.Errorf("%s: no waves", path)
+	}
+
+	seen := make(map[string]bool)
+	for i := range cfg.Waves {
+		w := &cfg.Waves[i]
+		if w.Name == "" {
+			w.Name = fmt.Sprintf("wave-%d", i+1)
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("%s: duplicate wave %q", path, w.Name)
+		}
+		seen[w.Name] = true
+
+		if len(w.Clusters) == 0 {
+			return nil, fmt.Errorf("%s: wave %q has no clusters", path, w.Name)
+		}
+
+		for j := range w.Clusters {
+			c := &w.Clusters[j]
+			if c.Cluster == "" {
+				return nil, fmt.Errorf("%s: wave %q: cluster %d has no name", path, w.Name, j)
+			}
+			if c.Project == "" {
+				c.Project = os.Getenv("GKE_PROJECT_ID")
+			}
+			if c.Zone == "" {
+				c.Zone = os.Getenv("GKE_ZONE")
+			}
+			if c.Project == "" || c.Zone == "" {
+				return nil, fmt.Errorf("%s: wave %q: cluster %q needs a project and zone, or GKE_PROJECT_ID and GKE_ZONE", path, w.Name, c.Cluster)
+			}
+			if c.Context == "" {
+				c.Context = kubeContext(c.Project, c.Zone, c.Cluster)
+			}
+		}
+	}
+
+	return &cfg, nil
+}
+
+func parseOptionalDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// rolloutState is saved after every step so an interrupted rollout continues
+// where it stopped
+type rolloutState struct {
+	Target   string               `json:"target"`
+	Upgraded map[string]time.Time `json:"upgraded"`
+	Waves    map[string]waveState `json:"waves"`
+}
+
+type waveState struct {
+	// Upgraded is when the last cluster of the wave was upgraded, the soak
+	// starts then
+	Upgraded time.Time `json:"upgraded"`
+	// Passed is when the wave passed its health gates after the soak
+	Passed time.Time `json:"passed"`
+}
+
+func loadRolloutState(path string) (*rolloutState, error) {
+	st := &rolloutState{
+		Upgraded: make(map[string]time.Time),
+		Waves:    make(map[string]waveState),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, st); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if st.Upgraded == nil {
+		st.Upgraded = make(map[string]time.Time)
+	}
+	if st.Waves == nil {
+		st.Waves = make(map[string]waveState)
+	}
+
+	return st, nil
+}
+
+func (st *rolloutState) save(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+type rollout struct {
+	svc       *container.Service
+	cfg       *rolloutConfig
+	st        *rolloutState
+	statePath string
+}
+
+// runRollout is the rollout command: it upgrades the masters and then the node
+// pools of every cluster of a wave, waits for the wave to soak and pass its
+// health gates, and only then starts the next wave
+func runRollout(svc *container.Service, configPath, statePath string) error {
+	cfg, err := loadRolloutConfig(configPath)
+	if err != nil {
+		return err
+	}
+	st, err := loadRolloutState(statePath)
+	if err != nil {
+		return err
+	}
+
+	r := &rollout{svc: svc, cfg: cfg, st: st, statePath: statePath}
+
+	if err := r.resolveTarget(); err != nil {
+		return err
+	}
+	fmt.Printf("Rolling out %s to %d waves, state in %s\n", st.Target, len(cfg.Waves), statePath)
+
+	for i, w := range cfg.Waves {
+		if ws, ok := st.Waves[w.Name]; ok && !ws.Passed.IsZero() {
+			fmt.Printf("Wave %q passed at %s, skipping\n", w.Name, ws.Passed.Format(time.RFC3339))
+			continue
+		}
+
+		if err := r.runWave(w, i == len(cfg.Waves)-1); err != nil {
+			return fmt.Errorf("wave %q: %v", w.Name, err)
+		}
+	}
+
+	fmt.Printf("Rollout of %s done\n", st.Target)
+	return nil
+}
+
+// resolveTarget pins the target version in the state the first time, with
+// the server config of the first cluster
+func (r *rollout) resolveTarget() error {
+	if r.st.Target != "" {
+		if r.cfg.Target != "" && r.cfg.Target != "latest" && r.cfg.Target != "default" && r.cfg.Target != r.st.Target {
+			return fmt.Errorf("state is for a rollout of %s, not %s; remove %s to start over", r.st.Target, r.cfg.Target, r.statePath)
+		}
+		return nil
+	}
+
+	first := r.cfg.Waves[0].Clusters[0]
+	sc, err := r.svc.Projects.Zones.GetServerconfig(first.Project, first.Zone).Do()
+	if err != nil {
+		return fmt.Errorf("failed to get server config: %v", err)
+	}
+
+	target, err := targetVersion(sc, r.cfg.Target)
+	if err != nil {
+		return err
+	}
+
+	r.st.Target = target
+	return r.st.save(r.statePath)
+}
+
+func (r *rollout) runWave(w rolloutWave, last bool) error {
+	ws := r.st.Waves[w.Name]
+
+	if ws.Upgraded.IsZero() {
+		fmt.Printf("Wave %q: upgrading %d clusters\n", w.Name, len(w.Clusters))
+
+		for _, c := range w.Clusters {
+			if at, ok := r.st.Upgraded[c.String()]; ok {
+				fmt.Printf("Cluster %s upgraded at %s, skipping\n", c, at.Format(time.RFC3339))
+				continue
+			}
+
+			if err := r.upgradeCluster(c); err != nil {
+				return fmt.Errorf("cluster %s: %v", c, err)
+			}
+
+			r.st.Upgraded[c.String()] = time.Now().UTC()
+			if err := r.st.save(r.statePath); err != nil {
+				return err
+			}
+		}
+
+		ws.Upgraded = time.Now().UTC()
+		r.st.Waves[w.Name] = ws
+		if err := r.st.save(r.statePath); err != nil {
+			return err
+		}
+	}
+
+	// there is no next wave to protect after the last one
+	if !last {
+		if wait := time.Until(ws.Upgraded.Add(r.cfg.soak)); wait > 0 {
+			fmt.Printf("Wave %q: soaking until %s\n", w.Name, ws.Upgraded.Add(r.cfg.soak).Format(time.RFC3339))
+			time.Sleep(wait)
+		}
+	}
+
+	for _, c := range w.Clusters {
+		kc, err := NewKubeClientForContext(c.Context)
+		if err != nil {
+			return fmt.Errorf("cluster %s: failed to create kubernetes client: %v", c, err)
+		}
+		// a resumed rollout didn't upgrade the cluster in this run, so the
+		// context wasn't checked yet
+		cl, err := r.svc.Projects.Zones.Clusters.Get(c.Project, c.Zone, c.Cluster).Do()
+		if err != nil {
+			return fmt.Errorf("cluster %s: %v", c, err)
+		}
+		if err := checkClusterNodes(kc, cl); err != nil {
+			return fmt.Errorf("cluster %s: context %s: %v", c, c.Context, err)
+		}
+		if err := waitHealthy(kc, c.String(), r.cfg.Namespaces, r.cfg.healthTimeout); err != nil {
+			return err
+		}
+	}
+
+	ws.Passed = time.Now().UTC()
+	r.st.Waves[w.Name] = ws
+	fmt.Printf("Wave %q passed its health gates\n", w.Name)
+
+	return r.st.save(r.statePath)
+}
+
+// upgradeCluster takes the master to the target one minor version at a time,
+// then brings every node pool to the master version, and checks the cluster
+// is healthy
+func (r *rollout) upgradeCluster(c rolloutCluster) error {
+	kc, err := NewKubeClientForContext(c.Context)
+	if err != nil {
+		return fmt.Errorf("failed to create kubernetes client: %v", err)
+	}
+
+	cl, err := r.svc.Projects.Zones.Clusters.Get(c.Project, c.Zone, c.Cluster).Do()
+	if err != nil {
+		return err
+	}
+	if err := checkClusterNodes(kc, cl); err != nil {
+		return fmt.Errorf("context %s: %v", c.Context, err)
+	}
+
+	fmt.Printf("Cluster %q (%s) master_version: v%s, node_count: %d\n", cl.Name, cl.Status,
+		cl.CurrentMasterVersion, cl.CurrentNodeCount)
+
+	sc, err := r.svc.Projects.Zones.GetServerconfig(c.Project, c.Zone).Do()
+	if err != nil {
+		return fmt.Errorf("failed to get server config: %v", err)
+	}
+
+	path, err := versions.Plan(cl.CurrentMasterVersion, r.st.Target, sc.ValidMasterVersions)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range path {
+		// bring the node pools along first when the hop would leave them
+		// too far behind
+		if checkSkew(cl, v) != nil {
+			if cl, err = r.upgradePools(c, cl); err != nil {
+				return err
+			}
+			if err := checkSkew(cl, v); err != nil {
+				return err
+			}
+		}
+
+		if err := r.prepare(c, cl, ""); err != nil {
+			return err
+		}
+		if err := checkDeprecatedAPIs(kc, cl.CurrentMasterVersion, v); err != nil {
+			return err
+		}
+
+		fmt.Printf("Upgrading master of %s from %s to %s\n", c, cl.CurrentMasterVersion, v)
+		if err := r.update(c, &container.ClusterUpdate{DesiredMasterVersion: v}); err != nil {
+			return err
+		}
+
+		if cl, err = r.svc.Projects.Zones.Clusters.Get(c.Project, c.Zone, c.Cluster).Do(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.upgradePools(c, cl); err != nil {
+		return err
+	}
+
+	return waitHealthy(kc, c.String(), r.cfg.Namespaces, r.cfg.healthTimeout)
+}
+
+// upgradePools brings every node pool behind the master to the master
+// version, and returns the cluster as it is then
+func (r *rollout) upgradePools(c rolloutCluster, cl *container.Cluster) (*container.Cluster, error) {
+	masterVersion, err := versions.Parse(cl.CurrentMasterVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, np := range cl.NodePools {
+		nodeVersion, err := versions.Parse(np.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse node version %s for %s nodepool: %v", np.Version, np.Name, err)
+		}
+		if !nodeVersion.LessThan(masterVersion) {
+			continue
+		}
+
+		if err := r.prepare(c, cl, np.Name); err != nil {
+			return nil, err
+		}
+
+		fmt.Printf("Upgrading node pool %s of %s from %s to %s\n", np.Name, c, np.Version, cl.CurrentMasterVersion)
+		err = r.update(c, &container.ClusterUpdate{
+			DesiredNodePoolId:  np.Name,
+			DesiredNodeVersion: cl.CurrentMasterVersion,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return r.svc.Projects.Zones.Clusters.Get(c.Project, c.Zone, c.Cluster).Do()
+}
+
+// prepare waits for operations blocking the change and for the cluster to be
+// allowed to change. It fails when the master changed while the change was
+// deferred, the plan is based on the version it had.
+func (r *rollout) prepare(c rolloutCluster, cl *container.Cluster, nodePoolID string) error {
+	ready, err := waitForBlockingOperations(r.svc, c.Project, c.Zone, c.Cluster, nodePoolID, true, *timeout)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return errDetached
+	}
+
+	now, err := enforceUpgradeWindow(r.svc, cl, c.Project, c.Zone, nodePoolID)
+	if err != nil {
+		return err
+	}
+	if now.CurrentMasterVersion != cl.CurrentMasterVersion {
+		return fmt.Errorf("master of %s changed from %s to %s while deferred", c, cl.CurrentMasterVersion, now.CurrentMasterVersion)
+	}
+	return nil
+}
+
+func (r *rollout) update(c rolloutCluster, update *container.ClusterUpdate) error {
+	upRequest := container.UpdateClusterRequest{
+		Name:   fmt.Sprintf("projects/%s/locations/%s/clusters/%s", c.Project, c.Zone, c.Cluster),
+		Update: update,
+	}
+
+	op, err := r.svc.Projects.Zones.Clusters.Update(c.Project, c.Zone, c.Cluster, &upRequest).Do()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("We're going to %s, status %s, id: %s\n", op.OperationType, op.Status, op.Name)
+
+	_, err = followOperation(r.svc, c.Project, c.Zone, op.Name, *timeout)
+	if err == errDetached {
+		return errors.New("detached, run rollout again to continue once the operation is done")
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pondohva/golang-samples/gke/versions"
+	"google.golang.org/api/container/v1"
+)
+
+// targetVersion resolves GKE_TARGET_VERSION against the server config, see
+// versions.Target
+func targetVersion(sc *container.ServerConfig, target string) (string, error) {
+	return versions.Target(sc.ValidMasterVersions, sc.DefaultClusterVersion, target)
+}
+
+// checkDowngrade fails when the target version asked for is lower than the
+// master version: GKE can't downgrade a master, and Plan has no path down
+// either. The newest valid version may be lower too once the master's version
+// is no longer offered, the master is then already at the latest.
+func checkDowngrade(masterVersion, asked, target string) error {
+	if asked == "" || asked == "latest" {
+		return nil
+	}
+
+	cur, err := versions.Parse(masterVersion)
+	if err != nil {
+		return fmt.Errorf("failed to parse master version %s: %v", masterVersion, err)
+	}
+	tgt, err := versions.Parse(target)
+	if err != nil {
+		return fmt.Errorf("failed to parse target version %s: %v", target, err)
+	}
+	if tgt.LessThan(cur) {
+		return fmt.Errorf("target version %s (%s) is lower than the master version %s, masters can't be downgraded", target, asked, masterVersion)
+	}
+	return nil
+}
+
+func nodePools(cl *container.Cluster) []versions.NodePool {
+	pools := make([]versions.NodePool, 0, len(cl.NodePools))
+	for _, np := range cl.NodePools {
+		pools = append(pools, versions.NodePool{Name: np.Name, Version: np.Version})
+	}
+	return pools
+}
+
+// printSkew is the skew report of the cluster against a master version
+func printSkew(cl *container.Cluster, masterVersion string) error {
+	return versions.PrintSkew(cl.Name, masterVersion, nodePools(cl))
+}
+
+// checkSkew fails when a master at masterVersion would leave node pools of
+// the cluster outside the supported skew
+func checkSkew(cl *container.Cluster, masterVersion string) error {
+	return versions.CheckSkew(masterVersion, nodePools(cl))
+}